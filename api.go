@@ -19,7 +19,8 @@ func LoadPackage(filePath string) (*pkg.Package, error) {
 // Run loads, builds, and runs the Go package located at the specified file path.
 // filePath is the file path to a folder that contains a main.go file
 // or any Go source file with a main function.
-func Run(filePath string) error {
+// Options configure the VM, e.g. pkg.WithRaceDetector.
+func Run(filePath string, options ...pkg.VMOption) error {
 	gopkg, err := pkg.LoadPackage(filePath, nil)
 	if err != nil {
 		return err
@@ -28,7 +29,7 @@ func Run(filePath string) error {
 	if err != nil {
 		return err
 	}
-	_, err = pkg.CallPackageFunction(p, "main", nil)
+	_, err = pkg.CallPackageFunction(p, "main", nil, options...)
 	return err
 }
 
@@ -46,6 +46,53 @@ func hasStepCommand() bool {
 	return len(os.Args) > 1 && os.Args[1] == "step"
 }
 
+func hasTestCommand() bool {
+	return len(os.Args) > 1 && os.Args[1] == "test"
+}
+
+// testArguments returns the path of the package, the -run expression and whether -v is given
+// from the arguments after the test sub command.
+func testArguments() (path string, run string, verbose bool) {
+	path = "."
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			path = args[i]
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch name {
+		case "v":
+			verbose = true
+		case "run":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			run = value
+		}
+	}
+	return
+}
+
+// runArguments splits the arguments after the run sub command into the flags of gi, the path of the program
+// and the arguments of the program. The path is the first argument that is not a flag ; "." if missing.
+// The program arguments follow the path, after an optional "--" that can also be given without a path.
+func runArguments() (flags []string, path string, args []string) {
+	path = "."
+	rest := os.Args[2:]
+	for len(rest) > 0 && rest[0] != "--" && strings.HasPrefix(rest[0], "-") {
+		flags, rest = append(flags, rest[0]), rest[1:]
+	}
+	if len(rest) > 0 && rest[0] != "--" {
+		path, rest = rest[0], rest[1:]
+	}
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	return flags, path, rest
+}
+
 func getLogDestFlag() string {
 	for _, each := range os.Args {
 		if strings.HasPrefix(each, "--log-dest") {
@@ -62,3 +109,30 @@ func getLogFlag() bool {
 	}
 	return false
 }
+
+func hasRaceFlag(flags []string) bool {
+	for _, each := range flags {
+		if each == "--race" || each == "-race" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasStdioFlag() bool {
+	for _, each := range os.Args {
+		if each == "--stdio" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMultiSessionFlag() bool {
+	for _, each := range os.Args {
+		if each == "--multi-session" {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/emicklei/gi"
+	"github.com/emicklei/gi/pkg"
 	"github.com/emicklei/gi/pkg/dap"
 )
 
@@ -12,10 +16,12 @@ import (
 //
 //  1. Start a DAP server for debugging
 //     Is activated when the dap sub command is invoked.
-//  2. Run a program from a directory of file
+//  2. Run a program from a directory or file, with arguments for the program
 //     Is activated when the run sub command is invoked.
 //  3. Step through a program from a directory of file
 //     Is activated when the step sub command is invoked.
+//  4. Run the tests of a package
+//     Is activated when the test sub command is invoked.
 func main() {
 	if hasDAPCommand() {
 		startDAP()
@@ -29,23 +35,137 @@ func main() {
 		runProgram()
 		return
 	}
+	if hasTestCommand() {
+		testPackage()
+		return
+	}
 	log.Println("[gi] unknown command")
 }
 
 // This accepts the Delve (dlv) flags and args because that is hardcoded in the vscode-go plugin. Example is:
 //
 // gi dap --listen=127.0.0.1:52950 --log-dest=3 --log
+//
+// With --stdio, a single session speaks DAP over stdin and stdout.
+// With --multi-session, the server keeps accepting connections and runs a session for each.
 func startDAP() {
+	if hasStdioFlag() {
+		// stdout is for protocol messages only ; other writes to os.Stdout go to stderr
+		log.SetOutput(os.Stderr)
+		protocol := os.Stdout
+		os.Stdout = os.Stderr
+		if err := dap.ServeStdio(os.Stdin, protocol); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	addr := flagValueString(getListenFlag())
 	srv := dap.Server{Addr: addr}
+	if hasMultiSessionFlag() {
+		if err := srv.Serve(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if err := srv.Start(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// runProgram runs the program of a directory or a Go source file with the arguments that follow it:
+//
+// gi run [--race] [path] [--] [args...]
+//
+// The exit code is that of the program, as with go run ; an uncaught panic prints its goroutine trace and exits with code 2.
 func runProgram() {
-	if err := gi.Run("."); err != nil {
+	flags, path, args := runArguments()
+	options := []pkg.VMOption{
+		// os.Args[0] is the program as given
+		pkg.WithArgs(append([]string{path}, args...)...),
+		pkg.WithOsExit(),
+		pkg.WithExceptionBreak(pkg.BreakOnUncaughtPanics),
+	}
+	if hasRaceFlag(flags) {
+		options = append(options, pkg.WithRaceDetector(os.Stderr))
+	}
+	p, err := buildProgram(path)
+	if err != nil {
+		print(err.Error())
+		os.Exit(1)
+	}
+	if _, err := pkg.CallPackageFunction(p, "main", nil, options...); err != nil {
+		if exit, ok := err.(pkg.ExitError); ok {
+			os.Exit(exit.Code)
+		}
+		if _, ok := err.(pkg.DeadlockError); ok {
+			// same as the Go runtime
+			print("fatal error: ", err.Error())
+			os.Exit(2)
+		}
+		if stop, ok := err.(*pkg.PanicStop); ok {
+			// same as the Go runtime
+			print(stop.Error(), "\n\n", stop.Stack)
+			os.Exit(2)
+		}
+		if race, ok := err.(pkg.RaceError); ok {
+			// same as go run -race
+			print(fmt.Sprintf("Found %d data race(s)\n", race.Count))
+			os.Exit(66)
+		}
 		print(err.Error())
 		os.Exit(1)
 	}
 }
+
+// buildProgram loads and builds the package of a directory or a Go source file.
+// Imported packages of the program are located by its module ; the program runs in the working directory
+// such that relative paths in its arguments are as given.
+func buildProgram(path string) (*pkg.Package, error) {
+	gopkg, err := pkg.LoadPackage(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.BuildPackage(gopkg)
+}
+
+// testPackage runs the tests and examples of the package in a directory, in that directory, as go test does:
+//
+// gi test [path] [-run regex] [-v]
+//
+// The exit code is 1 if a test failed or the package could not be built.
+func testPackage() {
+	path, run, verbose := testArguments()
+	started := time.Now()
+	// tests read files relative to the package, as with go test
+	if err := os.Chdir(path); err != nil {
+		fmt.Println(err)
+		fmt.Printf("FAIL\t%s [setup failed]\n", path)
+		os.Exit(1)
+	}
+	gopkg, err := pkg.LoadTestPackage(".")
+	if err != nil {
+		fmt.Println(err)
+		fmt.Printf("FAIL\t%s [setup failed]\n", path)
+		os.Exit(1)
+	}
+	if !slices.ContainsFunc(gopkg.GoFiles, func(file string) bool { return strings.HasSuffix(file, "_test.go") }) {
+		fmt.Printf("?   \t%s\t[no test files]\n", gopkg.PkgPath)
+		return
+	}
+	p, err := pkg.BuildPackage(gopkg)
+	if err != nil {
+		fmt.Println(err)
+		fmt.Printf("FAIL\t%s [build failed]\n", gopkg.PkgPath)
+		os.Exit(1)
+	}
+	passed, err := pkg.RunTests(p, pkg.TestConfig{Run: run, Verbose: verbose})
+	if err != nil {
+		fmt.Println(err)
+	}
+	elapsed := time.Since(started).Seconds()
+	if !passed {
+		fmt.Printf("FAIL\t%s\t%.3fs\n", gopkg.PkgPath, elapsed)
+		os.Exit(1)
+	}
+	fmt.Printf("ok  \t%s\t%.3fs\n", gopkg.PkgPath, elapsed)
+}
@@ -10,11 +10,24 @@ import (
 	"os"
 
 	"github.com/emicklei/gi"
+	"github.com/emicklei/gi/pkg/dap"
 )
 
 var port = flag.Int("port", 7171, "port to listen on")
+var debug = flag.String("debug", "", "address for a debugger to attach to, e.g. 127.0.0.1:52951")
+
+// host runs the scripts ; a debugger can attach to it if the debug flag is set
+var host = new(dap.Host)
 
 func main() {
+	flag.Parse()
+	if *debug != "" {
+		host.Addr = *debug
+		if err := host.Listen(); err != nil {
+			log.Fatal(err)
+		}
+		defer host.Close()
+	}
 	http.HandleFunc("POST /gi", handleGi)
 	log.Printf("starting remote exec server on http://0.0.0.0:%d/gi\n", *port)
 	http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
@@ -44,7 +57,7 @@ func handleGi(w http.ResponseWriter, r *http.Request) {
 	os.Stdout = ow
 
 	// call it
-	_, err = gi.Call(pkg, funcName)
+	_, err = host.Call(pkg, funcName)
 
 	// read stdout
 	ow.Close()
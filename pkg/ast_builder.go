@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"log/slog"
 	"os"
 	"path"
@@ -25,6 +26,8 @@ type astBuilder struct {
 	funcStack stack[funcDeclPair]
 	buildErr  error         // capture any error during building
 	constDecl *ConstVarDecl // current const decl for iota tracking
+	// names of the function literals of the package by position ; computed at the first literal
+	funcLitNames map[token.Pos]string
 }
 
 func newASTBuilder(goPkg *packages.Package) astBuilder {
@@ -35,6 +38,58 @@ func newASTBuilder(goPkg *packages.Package) astBuilder {
 
 func (b *astBuilder) Err() error { return b.buildErr }
 
+// funcLitNames returns the qualified names of the function literals of a package by their position, numbered
+// in each enclosing function as by the Go compiler: main.main.func1 and main.main.func1.1 for a literal inside it.
+// Literals in initializers of package variables are numbered in init.
+func funcLitNames(goPkg *packages.Package) map[token.Pos]string {
+	names := map[token.Pos]string{}
+	counts := map[string]int{} // literals numbered so far by prefix
+	var number func(node ast.Node, prefix, format string)
+	number = func(node ast.Node, prefix, format string) {
+		ast.Inspect(node, func(each ast.Node) bool {
+			lit, ok := each.(*ast.FuncLit)
+			if !ok || each == node {
+				return true
+			}
+			counts[prefix]++
+			name := fmt.Sprintf(format, prefix, counts[prefix])
+			names[lit.Type.Func] = name
+			number(lit, name, "%s.%d")
+			return false
+		})
+	}
+	for _, file := range goPkg.Syntax {
+		for _, decl := range file.Decls {
+			prefix := "init"
+			if fd, ok := decl.(*ast.FuncDecl); ok {
+				prefix = fd.Name.Name
+				if fd.Recv != nil && len(fd.Recv.List) > 0 {
+					prefix = types.ExprString(fd.Recv.List[0].Type) + "." + prefix
+					if strings.HasPrefix(prefix, "*") {
+						prefix = "(" + strings.Replace(prefix, ".", ").", 1)
+					}
+				}
+			}
+			number(decl, goPkg.Name+"."+prefix, "%s.func%d")
+		}
+	}
+	return names
+}
+
+// importDir returns the directory of an imported package of the module of the package being built.
+// Without a go.mod file of the package, the module is expected in the working directory.
+func (b *astBuilder) importDir(importPath string) (string, error) {
+	if len(b.goPkg.GoFiles) > 0 {
+		if modulePath, moduleDir, ok := moduleOf(filepath.Dir(b.goPkg.GoFiles[0])); ok {
+			if rel, ok := strings.CutPrefix(importPath, modulePath); ok && (rel == "" || rel[0] == '/') {
+				return filepath.Join(moduleDir, rel), nil
+			}
+		}
+	}
+	// the working directory is that of the module, named after its path
+	return filepath.Abs(filepath.Join("..", importPath))
+}
+
 func (b *astBuilder) pushEnv() {
 	b.env = b.env.newChild()
 }
@@ -187,11 +242,27 @@ func (b *astBuilder) Visit(node ast.Node) ast.Visitor {
 			}
 		}
 		b.push(s)
+	case *ast.GoStmt:
+		s := GoStmt{goPos: n.Go}
+		b.Visit(n.Call)
+		e := b.pop()
+		s.call = e.(CallExpr)
+		// store the call step in the GoStmt ; function and arguments are already on the stack
+		call := CallExpr{lparenPos: s.call.lparenPos, fun: noExpr{}, args: make([]Expr, len(s.call.args))}
+		for i := range call.args {
+			call.args[i] = noExpr{}
+		}
+		s.callStep = newGraphBuilder(b.goPkg).newStep(call)
+		b.push(s)
 	case *ast.FuncLit:
 		b.pushEnv()
 		defer b.popEnv()
 		// create pointer to FuncLit to allow modification later at buildtime
 		s := new(FuncLit)
+		if b.funcLitNames == nil {
+			b.funcLitNames = funcLitNames(b.goPkg)
+		}
+		s.name = b.funcLitNames[n.Type.Func]
 
 		b.pushFunc(s, n.Body.List)
 		defer b.popFunc()
@@ -248,6 +319,19 @@ func (b *astBuilder) Visit(node ast.Node) ast.Visitor {
 			s.Body = append(s.Body, e.(Stmt))
 		}
 		b.push(s)
+	case *ast.CommClause:
+		s := CommClause{casePos: n.Case}
+		if n.Comm != nil {
+			b.Visit(n.Comm)
+			e := b.pop()
+			s.comm = e.(Stmt)
+		}
+		for _, stmt := range n.Body {
+			b.Visit(stmt)
+			e := b.pop()
+			s.body = append(s.body, e.(Stmt))
+		}
+		b.push(s)
 	case *ast.MapType:
 		s := MapType{MapPos: n.Map}
 		b.Visit(n.Key)
@@ -346,6 +430,10 @@ func (b *astBuilder) Visit(node ast.Node) ast.Visitor {
 			break
 		}
 		s := Ident{name: n.Name, namePos: n.NamePos}
+		if fn, ok := builtins[n.Name]; ok && fn.Kind() == reflect.Func {
+			// replacements are looked up for these names only
+			s.builtinName = true
+		}
 		b.push(s)
 	case *ast.BlockStmt:
 		s := BlockStmt{lbracePos: n.Lbrace}
@@ -415,8 +503,7 @@ func (b *astBuilder) Visit(node ast.Node) ast.Visitor {
 		root := b.env.rootPackageEnv()
 		ffpkg := root.packages[unq]
 		if ffpkg == nil {
-			// strip module prefix
-			loc, err := filepath.Abs(filepath.Join("..", unq))
+			loc, err := b.importDir(unq)
 			if err != nil {
 				b.buildErr = fmt.Errorf("failed to locate imported package %s: %v", unq, err)
 				break
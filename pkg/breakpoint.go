@@ -0,0 +1,275 @@
+package pkg
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-dap"
+)
+
+// Breakpoint is a line or function breakpoint set by a debugger.
+// A line breakpoint is hit when a goroutine enters its line ; further steps on that line do not hit it again.
+// A function breakpoint is hit when a goroutine enters the first line of a call to that function.
+type Breakpoint struct {
+	Id   int
+	Path string // absolute file name
+	Line int
+	// qualified name of a function breakpoint, e.g. "main.handle", "(*Server).Serve" or "pkga.Init"
+	Function string
+	// id of the watched variable or field of a data breakpoint, as returned by DAPAccess.DataBreakpointInfo
+	DataId string
+	// watched variable or field of a data breakpoint, e.g. "s.requests" ; set when the data id is resolved
+	Data string
+	// Go expression evaluated in the frame environment ; the breakpoint is hit only if it is true
+	Condition string
+	// number of hits at which to stop: "5" or ">= 5" (at least 5), "== 5", "> 5", "< 5", "<= 5" or "% 5" (every 5th)
+	HitCondition string
+	// if set then the message is logged instead of stopping ; expressions in braces are interpolated, e.g. "i={i}"
+	LogMessage string
+
+	hitOp    token.Token
+	hitCount int
+	hits     int // times the line was entered while the condition was true
+}
+
+// NewBreakpoint returns a breakpoint for a source breakpoint of a DAP client.
+// It returns an error if the condition, hit condition or log message cannot be parsed.
+func NewBreakpoint(path string, sb dap.SourceBreakpoint) (*Breakpoint, error) {
+	bp := &Breakpoint{
+		Path:         filepath.Clean(path),
+		Line:         sb.Line,
+		Condition:    sb.Condition,
+		HitCondition: sb.HitCondition,
+		LogMessage:   sb.LogMessage,
+	}
+	return bp, bp.parse()
+}
+
+// NewFunctionBreakpoint returns a breakpoint for a function breakpoint of a DAP client.
+// It returns an error if the condition or hit condition cannot be parsed.
+func NewFunctionBreakpoint(fb dap.FunctionBreakpoint) (*Breakpoint, error) {
+	bp := &Breakpoint{
+		Function:     strings.TrimSpace(fb.Name),
+		Condition:    fb.Condition,
+		HitCondition: fb.HitCondition,
+	}
+	if bp.Function == "" {
+		return nil, fmt.Errorf("missing function name")
+	}
+	return bp, bp.parse()
+}
+
+// NewDataBreakpoint returns a breakpoint for a data breakpoint of a DAP client.
+// It returns an error if the access type is not write or the condition or hit condition cannot be parsed.
+func NewDataBreakpoint(db dap.DataBreakpoint) (*Breakpoint, error) {
+	if db.AccessType != "" && db.AccessType != "write" {
+		return nil, fmt.Errorf("access type %s is not supported, only write", db.AccessType)
+	}
+	bp := &Breakpoint{
+		DataId:       db.DataId,
+		Condition:    db.Condition,
+		HitCondition: db.HitCondition,
+	}
+	return bp, bp.parse()
+}
+
+// parse checks the condition, hit condition and log message.
+func (b *Breakpoint) parse() error {
+	if b.Condition != "" {
+		if _, err := parseExpr(b.Condition); err != nil {
+			return err
+		}
+	}
+	if b.HitCondition != "" {
+		op, count, err := parseHitCondition(b.HitCondition)
+		if err != nil {
+			return err
+		}
+		b.hitOp, b.hitCount = op, count
+	}
+	if b.LogMessage != "" {
+		_, err := interpolate(b.LogMessage, func(expr string) (string, error) {
+			_, err := parseExpr(expr)
+			return "", err
+		})
+		return err
+	}
+	return nil
+}
+
+// matchesFunction returns whether the breakpoint is set on the function with the given qualified name.
+// The package can be omitted, e.g. "(*Server).Serve" matches "main.(*Server).Serve".
+func (b *Breakpoint) matchesFunction(qualified string) bool {
+	return qualified == b.Function || strings.HasSuffix(qualified, "."+b.Function)
+}
+
+func (b *Breakpoint) String() string {
+	if b.Function != "" {
+		return b.Function
+	}
+	if b.Data != "" {
+		return b.Data
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(b.Path), b.Line)
+}
+
+// parseHitCondition returns the operator and count of a hit condition ; a count only means at least.
+func parseHitCondition(s string) (token.Token, int, error) {
+	op := token.GEQ
+	rest := strings.TrimSpace(s)
+	for _, each := range []token.Token{token.EQL, token.GEQ, token.LEQ, token.GTR, token.LSS, token.REM} {
+		if after, ok := strings.CutPrefix(rest, each.String()); ok {
+			op, rest = each, strings.TrimSpace(after)
+			break
+		}
+	}
+	count, err := strconv.Atoi(rest)
+	if err != nil || count < 0 || (op == token.REM && count == 0) {
+		return token.ILLEGAL, 0, fmt.Errorf("invalid hit condition %q", s)
+	}
+	return op, count, nil
+}
+
+// hit counts a hit and returns whether the hit condition, if any, is met.
+func (b *Breakpoint) hit() bool {
+	b.hits++
+	switch b.hitOp {
+	case token.EQL:
+		return b.hits == b.hitCount
+	case token.GEQ:
+		return b.hits >= b.hitCount
+	case token.LEQ:
+		return b.hits <= b.hitCount
+	case token.GTR:
+		return b.hits > b.hitCount
+	case token.LSS:
+		return b.hits < b.hitCount
+	case token.REM:
+		return b.hits%b.hitCount == 0
+	}
+	return true
+}
+
+// interpolate returns the message with each expression in braces replaced by the result of eval.
+// Braces inside an expression, e.g. of a composite literal, must be balanced.
+func interpolate(message string, eval func(expr string) (string, error)) (string, error) {
+	buf := new(strings.Builder)
+	for rest := message; ; {
+		open := strings.IndexByte(rest, '{')
+		if open == -1 {
+			buf.WriteString(rest)
+			return buf.String(), nil
+		}
+		buf.WriteString(rest[:open])
+		depth, end := 0, -1
+		for i := open; i < len(rest) && end == -1; i++ {
+			switch rest[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end == -1 {
+			return "", fmt.Errorf("missing } in log message %q", message)
+		}
+		value, err := eval(rest[open+1 : end])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(value)
+		rest = rest[end+1:]
+	}
+}
+
+// enterLine moves the current frame to the line of its next step.
+// It returns the file and line if the frame was not on that line already.
+func (vm *VM) enterLine() (file string, line int, entered bool) {
+	frame := vm.currentFrame
+	if frame == nil {
+		return "", 0, false
+	}
+	p := vm.positionOf(frame, frame.step)
+	if !p.IsValid() || p.Line == frame.line {
+		return "", 0, false
+	}
+	frame.line = p.Line
+	return p.Filename, p.Line, true
+}
+
+// positionOf returns the source position of a step of a frame ; invalid if the step has no position.
+func (vm *VM) positionOf(frame *stackFrame, step Step) token.Position {
+	if step == nil || step.pos() == token.NoPos {
+		return token.Position{}
+	}
+	return vm.fileSetOf(frame).Position(step.pos())
+}
+
+// fileSetOf returns the file set of the positions in the function of a frame.
+func (vm *VM) fileSetOf(frame *stackFrame) *token.FileSet {
+	if fn, ok := frame.callee.(*FuncDecl); ok && fn.fileSet != nil {
+		// declared in a subpackage
+		return fn.fileSet
+	}
+	return vm.pkg.Fset
+}
+
+// packageOfFrame returns the package of the function of a frame, which is that of the package environment of the frame.
+func (vm *VM) packageOfFrame(frame *stackFrame) *Package {
+	if frame.env == nil {
+		return vm.pkg
+	}
+	root := frame.env.rootPackageEnv()
+	for _, each := range vm.pkg.env.packages {
+		if each.env == root {
+			return each
+		}
+	}
+	return vm.pkg
+}
+
+// breakpointLocations returns the positions of the statements that begin on the lines of a source file from line to
+// endLine, the first one of each line ; the VM stops at lines, not at columns.
+func (vm *VM) breakpointLocations(file string, line, endLine int) (locations []token.Position) {
+	starts := vm.statementStarts(file)
+	for each := line; each <= max(line, endLine); each++ {
+		if p, ok := starts[each]; ok {
+			locations = append(locations, p)
+		}
+	}
+	return
+}
+
+// funcDecls returns the interpreted functions and methods of the main package and its subpackages.
+func (vm *VM) funcDecls() (decls []*FuncDecl) {
+	pkgs := []*Package{vm.pkg}
+	for _, each := range vm.pkg.env.packages {
+		pkgs = append(pkgs, each)
+	}
+	for _, each := range pkgs {
+		env, ok := each.env.Env.(*Environment)
+		if !ok {
+			continue
+		}
+		for _, v := range env.values {
+			if !v.IsValid() || !v.CanInterface() {
+				continue
+			}
+			switch d := v.Interface().(type) {
+			case *FuncDecl:
+				decls = append(decls, d)
+			case HasMethods:
+				for _, m := range d.methodsMap() {
+					decls = append(decls, m)
+				}
+			}
+		}
+	}
+	return
+}
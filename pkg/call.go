@@ -1,9 +1,11 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
 	"go/token"
 	"reflect"
+	"slices"
 )
 
 var _ Expr = CallExpr{}
@@ -34,6 +36,8 @@ func (c CallExpr) eval(vm *VM) {
 			c.handleExtendedType(vm, f)
 		case FuncDecl:
 			c.handleFuncDecl(vm, &f)
+		case subtestRun:
+			c.handleSubtest(vm, f)
 		default:
 			vm.fatalf("struct unexpected %s (%T)", stringOf(fn.Interface()), fn.Interface())
 		}
@@ -119,10 +123,34 @@ func (c CallExpr) handleFunc(vm *VM, fn reflect.Value) {
 			args[i] = val
 		}
 	}
+	vm.escapeChannels(args)
+	if vm.race != nil {
+		vm.race.beforeCall(fn, args)
+	}
+	if vm.hasOtherRoutines() {
+		if reason, ok := blockingFuncReason(fn); ok {
+			vm.callBlocking(fn, args, reason, waitSDK)
+			return
+		}
+	}
 	vals := fn.Call(args)
 	vm.pushOperands(vals...)
 }
 
+// handleSubtest calls the function of a subtest, if selected, with a testingT below the receiver of t.Run.
+// Its result is pushed once the subtest has ended ; true if not selected.
+func (c CallExpr) handleSubtest(vm *VM, sr subtestRun) {
+	// first to last, see Flow
+	name := vm.popOperand()
+	fn := vm.popOperand()
+	t := sr.t.subtest(name.String())
+	if !sr.t.run.selected(t) {
+		vm.pushOperand(reflect.ValueOf(true))
+		return
+	}
+	sr.t.run.start(t, fn)
+}
+
 func (c CallExpr) handleExtendedType(vm *VM, et ExtendedType) {
 	arg := vm.popOperand()
 	val := ExtendedValue{
@@ -156,8 +184,25 @@ func (c CallExpr) handleReflectMethod(vm *VM, rm reflect.Method) {
 		args[i+1] = val
 	}
 
+	vm.escapeChannels(args)
+	var acquire any
+	if vm.race != nil {
+		acquire = vm.race.beforeMethodCall(rm, receiver)
+	}
+	if vm.hasOtherRoutines() {
+		if reason, ok := blockingMethodReason(rm.Type.In(0), rm.Name); ok {
+			vm.callBlocking(rm.Func, args, reason, waitRoutines)
+			if acquire != nil {
+				vm.race.acquireOnWake(acquire)
+			}
+			return
+		}
+	}
 	// Call the method using rm.Func
 	vals := rm.Func.Call(args)
+	if acquire != nil {
+		vm.race.acquire(acquire)
+	}
 	vm.pushOperands(vals...)
 }
 
@@ -276,21 +321,7 @@ func (c CallExpr) handleFuncDecl(vm *VM, fd *FuncDecl) {
 
 	// if method, set receiver in env
 	if fd.recv != nil {
-		recvName := fd.recv.List[0].names[0].name
-		// check pointer receiver
-		if isPointerExpr(fd.recv.List[0].typ) {
-			frame.env.valueSet(recvName, receiver)
-		} else {
-			// put a copy of the value
-			if sv, ok := receiver.Interface().(StructValue); ok {
-				clone := sv.clone()
-				frame.env.valueSet(recvName, reflect.ValueOf(clone))
-			}
-			if ev, ok := receiver.Interface().(ExtendedValue); ok {
-				// no need to clone value
-				frame.env.valueSet(recvName, reflect.ValueOf(ev))
-			}
-		}
+		setReceiverForFrame(fd.recv, receiver, frame)
 	}
 
 	setParametersForFrame(fd.typ, args, vm, frame)
@@ -311,8 +342,34 @@ func setZeroReturnsForFrame(ft *FuncType, vm *VM, frame *stackFrame) {
 	}
 }
 
+// setReceiverForFrame puts the receiver of a method call in the env of the new frame
+func setReceiverForFrame(recv *FieldList, receiver reflect.Value, frame *stackFrame) {
+	// keep for restarting the frame
+	frame.recv = receiver
+	recvName := recv.List[0].names[0].name
+	// check pointer receiver
+	if isPointerExpr(recv.List[0].typ) {
+		frame.env.valueSet(recvName, receiver)
+	} else {
+		// put a copy of the value
+		if sv, ok := receiver.Interface().(StructValue); ok {
+			clone := sv.clone()
+			frame.env.valueSet(recvName, reflect.ValueOf(clone))
+		}
+		if ev, ok := receiver.Interface().(ExtendedValue); ok {
+			// no need to clone value
+			frame.env.valueSet(recvName, reflect.ValueOf(ev))
+		}
+	}
+}
+
 // setParametersForFrame takes all parameters and put them in the env of the new frame
 func setParametersForFrame(ft *FuncType, args []reflect.Value, vm *VM, frame *stackFrame) {
+	if vm.keepCallArgs {
+		// keep the arguments for restarting the frame
+		frame.funcEnv = frame.env
+		frame.args = args
+	}
 	if ft.Params == nil {
 		return
 	}
@@ -325,6 +382,10 @@ func setParametersForFrame(ft *FuncType, args []reflect.Value, vm *VM, frame *st
 				val = reflect.Zero(makeType(vm, field.typ)) // TODO put types from gopkg in Field?
 			}
 			frame.env.valueSet(name.name, val)
+			// the function can change a struct parameter ; keep a copy
+			if sv, ok := val.Interface().(StructValue); ok && vm.keepCallArgs {
+				args[p] = reflect.ValueOf(sv.clone())
+			}
 			p++
 		}
 	}
@@ -427,3 +488,42 @@ func (c CallExpr) pos() token.Pos { return c.lparenPos }
 func (c CallExpr) String() string {
 	return fmt.Sprintf("CallExpr(%v, len=%d)", c.fun, len(c.args))
 }
+
+// restartFrame removes the frames above a frame of the running routine and calls its function again
+// with the arguments and receiver of the original call. Deferred calls of the removed frames are not run.
+func (vm *VM) restartFrame(frame *stackFrame) error {
+	if !slices.Contains(vm.callStack, frame) {
+		return errors.New("frame is not in the current goroutine")
+	}
+	var ft *FuncType
+	var recv *FieldList
+	var head Step
+	switch f := frame.callee.(type) {
+	case *FuncDecl:
+		ft, recv, head = f.typ, f.recv, f.callGraph
+	case *FuncLit:
+		ft, head = f.Type, f.callGraph
+	}
+	if ft == nil || frame.funcEnv == nil {
+		return errors.New("frame is not a call of an interpreted function")
+	}
+	if vm.journal != nil {
+		// restarting can be undone by stepping back
+		vm.journal.begin(vm)
+		defer func() { vm.journal.current = nil }()
+	}
+	for vm.currentFrame != frame {
+		vm.popFrame()
+	}
+	frame.env = newEnvironment(frame.funcEnv.parent())
+	frame.operands = frame.operands[:0]
+	frame.defers = frame.defers[:0]
+	frame.line = 0
+	if recv != nil {
+		setReceiverForFrame(recv, frame.recv, frame)
+	}
+	setParametersForFrame(ft, frame.args, vm, frame)
+	setZeroReturnsForFrame(ft, vm, frame)
+	frame.step = head
+	return nil
+}
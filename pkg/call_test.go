@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"io"
 	"reflect"
 	"testing"
 )
@@ -87,3 +88,38 @@ func main() {
 	print("post-f")
 }`, "pre-f2post-f")
 }
+
+func TestCallKeepsArgumentsOnlyForDebuggers(t *testing.T) {
+	pkg := buildPackage(t, `package main
+
+func f(in int) int {
+	return in + 1
+}
+
+func main() {
+	print(f(1))
+}`)
+	for _, debugging := range []bool{false, true} {
+		vm := NewVM(pkg)
+		collectPrintOutput(vm)
+		if debugging {
+			NewDAPAccess(vm)
+		}
+		vm.launch("main", nil)
+		kept := false
+		for {
+			if err := vm.Next(); err != nil {
+				if err == io.EOF {
+					break
+				}
+				t.Fatal(err)
+			}
+			if vm.currentFrame != nil && vm.currentFrame.args != nil {
+				kept = true
+			}
+		}
+		if kept != debugging {
+			t.Errorf("got arguments kept %v want %v", kept, debugging)
+		}
+	}
+}
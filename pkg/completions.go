@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-dap"
+)
+
+// Completions returns the names that complete the identifier before the column of the text, such as typed in the
+// debug console, in the frame with the given id or else the current frame. The column is 1-based.
+// An identifier completes to a variable, function, type or package in scope ; after a dot it completes to a field
+// or method of the value before the dot, or to a symbol of the package before the dot.
+func (a *DAPAccess) Completions(text string, column int, frameId int) (items []dap.CompletionItem) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	frame := a.vm.currentFrame
+	if frameId != 0 {
+		frame = a.frameOf(frameId)
+	}
+	if frame == nil || frame.env == nil {
+		return nil
+	}
+	runes := []rune(text)
+	column = min(max(column-1, 0), len(runes))
+	fragment := string(runes[:column])
+	start := strings.LastIndexFunc(fragment, func(r rune) bool {
+		return r != '.' && r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	fragment = fragment[start+1:]
+	var candidates map[string]string // name -> completion item type
+	partial := fragment
+	if dot := strings.LastIndexByte(fragment, '.'); dot != -1 {
+		partial = fragment[dot+1:]
+		candidates = a.membersOf(frame, fragment[:dot])
+	} else {
+		candidates = namesInScope(frame.env)
+	}
+	for name, kind := range candidates {
+		if strings.HasPrefix(name, partial) && name != partial {
+			items = append(items, dap.CompletionItem{Label: name, Type: dap.CompletionItemType(kind)})
+		}
+	}
+	slices.SortFunc(items, func(x, y dap.CompletionItem) int { return strings.Compare(x.Label, y.Label) })
+	return
+}
+
+// isSelectorChain returns whether an expression is a name or a selector of a selector chain, e.g. a.b.c.
+func isSelectorChain(x ast.Expr) bool {
+	switch e := x.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isSelectorChain(e.X)
+	}
+	return false
+}
+
+// namesInScope returns the names that are declared in an environment and its parents, by completion item type.
+func namesInScope(env Env) map[string]string {
+	names := map[string]string{}
+	for ; env != nil; env = env.parent() {
+		for name, v := range valuesOf(env) {
+			if _, ok := names[name]; ok || strings.HasPrefix(name, "_") {
+				// shadowed or internal
+				continue
+			}
+			names[name] = completionTypeOf(v)
+		}
+	}
+	return names
+}
+
+// valuesOf returns the values declared in an environment by name.
+func valuesOf(env Env) map[string]reflect.Value {
+	switch e := env.(type) {
+	case *Environment:
+		return e.values
+	case *PkgEnvironment:
+		return valuesOf(e.Env)
+	}
+	return nil
+}
+
+// completionTypeOf returns the type of a completion item for a declared value.
+func completionTypeOf(v reflect.Value) string {
+	if !v.IsValid() {
+		return "variable"
+	}
+	switch v.Interface().(type) {
+	case *FuncDecl, builtinFunc:
+		return "function"
+	case SDKPackage, ExternalPackage, *Package:
+		return "module"
+	case StructType, ExtendedType, builtinType:
+		return "class"
+	}
+	if v.Kind() == reflect.Func {
+		return "function"
+	}
+	return "variable"
+}
+
+// membersOf returns the fields and methods of the value of an expression, or the exported symbols if it names
+// a package, by completion item type. Only a name or a chain of selectors is evaluated, such that completing
+// cannot call functions of the program.
+func (a *DAPAccess) membersOf(frame *stackFrame, expr string) map[string]string {
+	var v reflect.Value
+	if token.IsIdentifier(expr) {
+		v = frame.env.valueLookUp(expr)
+	} else {
+		x, err := parseExpr(expr)
+		if err != nil || !isSelectorChain(x) {
+			return nil
+		}
+		result, err := a.vm.evalExprIn(frame, expr)
+		if err != nil {
+			return nil
+		}
+		v = result
+	}
+	if !v.IsValid() || v == reflectUndeclared {
+		return nil
+	}
+	members := map[string]string{}
+	switch p := v.Interface().(type) {
+	case SDKPackage:
+		addPackageSymbols(members, p)
+		return members
+	case ExternalPackage:
+		addPackageSymbols(members, p.SDKPackage)
+		return members
+	case *Package:
+		for name, each := range valuesOf(p.env) {
+			if token.IsExported(name) {
+				members[name] = completionTypeOf(each)
+			}
+		}
+		return members
+	}
+	v = a.dereference(v)
+	if sv, ok := v.Interface().(StructValue); ok {
+		for _, field := range sv.structType.fields.List {
+			for _, name := range field.names {
+				members[name.name] = "field"
+			}
+		}
+		for name := range sv.structType.methods {
+			members[name] = "method"
+		}
+		return members
+	}
+	addGoMembers(members, v)
+	return members
+}
+
+// dereference returns the value that a heap pointer or Go pointer to an interpreted value points to ;
+// other values are returned as is. Reading does not count as an access by the program.
+func (a *DAPAccess) dereference(v reflect.Value) reflect.Value {
+	if hp, ok := v.Interface().(*HeapPointer); ok {
+		if hp.env != nil {
+			return hp.env.valueLookUp(hp.envVarName)
+		}
+		if stored, ok := a.vm.heap.values[hp.addr]; ok {
+			return stored
+		}
+		return v
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		return v.Elem()
+	}
+	return v
+}
+
+func addPackageSymbols(members map[string]string, p SDKPackage) {
+	for name, each := range p.symbols {
+		if each.Kind() == reflect.Func {
+			members[name] = "function"
+		} else {
+			members[name] = "variable"
+		}
+	}
+	for name := range p.types {
+		members[name] = "class"
+	}
+}
+
+// addGoMembers adds the exported fields and methods of a Go value. Methods with a pointer receiver are included
+// because Go takes the address of a variable to call them.
+func addGoMembers(members map[string]string, v reflect.Value) {
+	t := v.Type()
+	if t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface {
+		t = reflect.PointerTo(t)
+	}
+	for i := range t.NumMethod() {
+		members[t.Method(i).Name] = "method"
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		for _, each := range reflect.VisibleFields(t) {
+			if each.IsExported() {
+				members[each.Name] = "field"
+			}
+		}
+	}
+}
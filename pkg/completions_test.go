@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+const completionsSource = `package main
+
+import "strings"
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) Sum() int { return p.X + p.Y }
+
+var origin Point
+
+func main() {
+	point := Point{X: 1, Y: 2}
+	pointer := &point
+	builder := new(strings.Builder)
+	builder.WriteString("hi")
+	print(point.Sum(), pointer.X, builder.Len())
+}`
+
+func labelsOf(items []dap.CompletionItem) (labels []string) {
+	for _, each := range items {
+		labels = append(labels, each.Label)
+	}
+	return
+}
+
+func TestCompletions(t *testing.T) {
+	xs := continueToBreakpointIn(t, completionsSource, 18)
+	for _, each := range []struct {
+		text string
+		want []string
+	}{
+		{"po", []string{"point", "pointer"}},
+		{"pr", []string{"print", "println"}},
+		{"or", []string{"origin"}},
+		{"Po", []string{"Point"}},
+		{"point.", []string{"Sum", "X", "Y"}},
+		{"pointer.", []string{"Sum", "X", "Y"}},
+		{"x + point.S", []string{"Sum"}},
+		{"builder.Wr", []string{"Write", "WriteByte", "WriteRune", "WriteString"}},
+		{"strings.HasP", []string{"HasPrefix"}},
+		{"strings.Build", []string{"Builder"}},
+		{"point.X", nil},
+		{"unknown.", nil},
+	} {
+		got := labelsOf(xs.Completions(each.text, len(each.text)+1, 0))
+		if !slices.Equal(got, each.want) {
+			t.Errorf("%q: got %v want %v", each.text, got, each.want)
+		}
+	}
+}
+
+func TestCompletionsItemTypes(t *testing.T) {
+	xs := continueToBreakpointIn(t, completionsSource, 18)
+	types := map[string]dap.CompletionItemType{}
+	for _, each := range xs.Completions("", 1, 0) {
+		types[each.Label] = each.Type
+	}
+	for label, want := range map[string]dap.CompletionItemType{
+		"point":   "variable",
+		"main":    "function",
+		"len":     "function",
+		"Point":   "class",
+		"strings": "module",
+	} {
+		if got := types[label]; got != want {
+			t.Errorf("%s: got %q want %q", label, got, want)
+		}
+	}
+}
+
+func TestCompletionsBeforeColumn(t *testing.T) {
+	xs := continueToBreakpointIn(t, completionsSource, 18)
+	// the caret is after "poi" in "poi + 1"
+	got := labelsOf(xs.Completions("poi + 1", 4, 0))
+	if want := []string{"point", "pointer"}; !slices.Equal(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestCompletionsOnlySelectorChains(t *testing.T) {
+	xs := continueToBreakpointIn(t, completionsSource, 18)
+	if got := xs.membersOf(xs.vm.currentFrame, "pointer.X"); len(got) != 0 {
+		t.Errorf("got %v want none for an int", got)
+	}
+	if got := xs.membersOf(xs.vm.currentFrame, "point"); len(got) != 3 {
+		t.Errorf("got %v want the members of Point", got)
+	}
+	// calls are not evaluated
+	for _, each := range []string{"point.Sum()", "builder.String()", "Point{}"} {
+		if got := xs.membersOf(xs.vm.currentFrame, each); got != nil {
+			t.Errorf("%s: got %v want none", each, got)
+		}
+	}
+	if got, want := xs.vm.currentFrame.env.valueLookUp("builder").Interface().(*strings.Builder).Len(), 2; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
@@ -27,8 +27,9 @@ func (c ChanType) flow(g *graphBuilder) (head Step) {
 func (c ChanType) makeValue(vm *VM, buffer int, elements []reflect.Value) reflect.Value {
 	typ := makeType(vm, c.valueType)
 	dir := reflect.ChanDir(c.dir)
-	ch := reflect.ChanOf(dir, typ)
-	return reflect.MakeChan(ch, int(buffer))
+	ch := reflect.MakeChan(reflect.ChanOf(dir, typ), int(buffer))
+	vm.trackChannel(ch)
+	return ch
 }
 func (c ChanType) literalCompose(vm *VM, composite reflect.Value, values []reflect.Value) reflect.Value {
 	// TODO
@@ -54,7 +55,14 @@ func (s SendStmt) eval(vm *VM) {
 	// stack: value, chan
 	val := vm.popOperand()
 	ch := vm.popOperand()
-	ch.Send(val)
+	if vm.race != nil {
+		vm.race.release(syncObject(ch))
+	}
+	if ch.TrySend(val) {
+		return
+	}
+	// let other routines make progress until the value can be sent
+	vm.park([]reflect.SelectCase{{Dir: reflect.SelectSend, Chan: ch, Send: val}}, "chan send", nil)
 }
 
 func (s SendStmt) flow(g *graphBuilder) (head Step) {
@@ -74,21 +82,260 @@ func (s SendStmt) String() string {
 	return fmt.Sprintf("SendStmt(%v <- %v)", s.chann, s.value)
 }
 
+var _ Stmt = GoStmt{}
+
+type GoStmt struct {
+	goPos token.Pos
+	call  CallExpr
+	// detached flow that makes the call in the new routine
+	callStep Step
+}
+
+// eval takes the function and its arguments from the operand stack and
+// starts a new routine with them.
+func (s GoStmt) eval(vm *VM) {
+	fn := vm.popOperand()
+	values := []reflect.Value{fn}
+	// methods have their receiver on the stack
+	switch f := fn.Interface().(type) {
+	case *FuncDecl:
+		if f.recv != nil {
+			values = append(values, vm.popOperand())
+		}
+	case reflect.Method:
+		values = append(values, vm.popOperand())
+	}
+	for range s.call.args {
+		values = append(values, vm.popOperand())
+	}
+	vm.startRoutine(s.goPos, vm.currentEnv(), s.callStep, values)
+}
+
+func (s GoStmt) flow(g *graphBuilder) (head Step) {
+	// function and arguments are evaluated in the current routine
+	for i := len(s.call.args) - 1; i >= 0; i-- {
+		argFlow := s.call.args[i].flow(g)
+		if i == len(s.call.args)-1 {
+			head = argFlow
+		}
+	}
+	funFlow := s.call.fun.flow(g)
+	if head == nil {
+		head = funFlow
+	}
+	g.next(s)
+	return head
+}
+
+func (s GoStmt) stmtStep() Evaluable { return s }
+
+func (s GoStmt) pos() token.Pos {
+	return s.goPos
+}
+
+func (s GoStmt) String() string {
+	return fmt.Sprintf("GoStmt(%v)", s.call)
+}
+
 var _ Stmt = (*SelectStmt)(nil)
 
 type SelectStmt struct {
 	selectPos token.Pos
 	body      *BlockStmt // CommClauses only
+	// computed at flow time
+	dirs          []reflect.SelectDir // direction of each case with a channel operation
+	clauses       []int               // index of the clause of each case with a channel operation
+	defaultClause int                 // index of the default clause; or -1
 }
 
-// https://www.geeksforgeeks.org/go-language/reflect-select-function-in-golang-with-examples/
-func (s SelectStmt) eval(vm *VM) {}
+// eval takes the channels, and the values to send, of all cases from the operand stack.
+// It pushes the index of the chosen clause, the received value and whether a value was received.
+// If no operation can complete and there is no default clause then the routine parks until one can.
+func (s SelectStmt) eval(vm *VM) {
+	// stack: chan, value (if send) for each case
+	cases := make([]reflect.SelectCase, len(s.dirs))
+	for i := len(s.dirs) - 1; i >= 0; i-- {
+		cases[i].Dir = s.dirs[i]
+		if s.dirs[i] == reflect.SelectSend {
+			cases[i].Send = vm.popOperand()
+		}
+		cases[i].Chan = vm.popOperand()
+	}
+	if chosen, recv, recvOK := vm.pollCases(cases); chosen >= 0 {
+		s.selected(vm, cases, chosen, recv, recvOK)
+		return
+	}
+	if s.defaultClause >= 0 {
+		vm.pushOperands(reflect.ValueOf(s.defaultClause), reflect.ValueOf(false), reflect.ValueOf(false))
+		return
+	}
+	// let other routines make progress until one of the operations can complete
+	reason := "select"
+	if len(cases) == 0 {
+		reason = "select (no cases)"
+	}
+	vm.park(cases, reason, func(vm *VM, chosen int, recv reflect.Value, recvOK bool) {
+		s.selected(vm, cases, chosen, recv, recvOK)
+	})
+}
 
+// selected pushes the outcome of the completed operation of a case for the assignment that follows the select.
+func (s SelectStmt) selected(vm *VM, cases []reflect.SelectCase, chosen int, recv reflect.Value, recvOK bool) {
+	ch := cases[chosen].Chan
+	if cases[chosen].Dir == reflect.SelectSend {
+		if vm.race != nil {
+			vm.race.release(syncObject(ch))
+		}
+		// nothing was received
+		recv = reflect.ValueOf(false)
+	} else {
+		if vm.race != nil {
+			vm.race.acquire(syncObject(ch))
+		}
+		if !recvOK {
+			// closed
+			recv = reflect.Zero(ch.Type().Elem())
+		}
+	}
+	vm.pushOperands(reflect.ValueOf(s.clauses[chosen]), recv, reflect.ValueOf(recvOK))
+}
+
+// flow evaluates the channels, and the values to send, of all cases in source order, as Go does,
+// and continues with the body of the chosen clause.
 func (s SelectStmt) flow(g *graphBuilder) (head Step) {
-	return g.current
+	s.defaultClause = -1
+	var list []Stmt
+	if s.body != nil {
+		list = s.body.list
+	}
+	for i, stmt := range list {
+		clause := stmt.(CommClause)
+		if clause.comm == nil {
+			s.defaultClause = i
+			continue
+		}
+		var ch, value Expr
+		dir := reflect.SelectRecv
+		switch comm := clause.comm.(type) {
+		case SendStmt:
+			ch, value, dir = comm.chann, comm.value, reflect.SelectSend
+		case ExprStmt:
+			ch = receivedChannel(comm.x)
+		case AssignStmt:
+			ch = receivedChannel(comm.rhs[0])
+		}
+		if ch == nil {
+			g.fatal(fmt.Sprintf("unsupported select case: %v", clause.comm))
+		}
+		chFlow := ch.flow(g)
+		if head == nil {
+			head = chFlow
+		}
+		if value != nil {
+			value.flow(g)
+		}
+		s.dirs = append(s.dirs, dir)
+		s.clauses = append(s.clauses, i)
+	}
+	g.next(s)
+	if head == nil {
+		head = g.current
+	}
+	if len(list) == 0 {
+		// blocks forever
+		return head
+	}
+
+	// the outcome is on the operand stack
+	chosenVar := Ident{namePos: s.pos(), name: internalVarName("select-chosen", g.idgen)}
+	recvVar := Ident{namePos: s.pos(), name: internalVarName("select-recv", g.idgen)}
+	okVar := Ident{namePos: s.pos(), name: internalVarName("select-ok", g.idgen)}
+	outcome := AssignStmt{
+		tokPos: s.pos(),
+		tok:    token.DEFINE,
+		lhs:    []Expr{chosenVar, recvVar, okVar},
+		rhs:    []Expr{noExpr{}, noExpr{}, noExpr{}},
+	}
+	outcome.flow(g)
+
+	// need to know the end of the select for 'break' statements in the clauses
+	end := g.newLabeledStep("~select-end", s.pos())
+	g.breakStack.push(end)
+	defer g.breakStack.pop()
+
+	// compose if-else statements, one for each clause, in reverse
+	var when Stmt
+	for i := len(list) - 1; i >= 0; i-- {
+		clause := list[i].(CommClause)
+		body := clause.body
+		if assign, ok := clause.comm.(AssignStmt); ok {
+			// v, ok := <-ch
+			values := AssignStmt{
+				tokPos: assign.tokPos,
+				tok:    assign.tok,
+				lhs:    assign.lhs,
+				rhs:    []Expr{recvVar, okVar}[:len(assign.lhs)],
+			}
+			body = append([]Stmt{values}, body...)
+		}
+		when = IfStmt{
+			ifPos: clause.pos(),
+			cond: BinaryExpr{
+				op:    token.EQL,
+				opPos: clause.pos(),
+				x:     chosenVar,
+				y:     newBasicLit(clause.pos(), reflect.ValueOf(i)),
+			},
+			body:   &BlockStmt{lbracePos: clause.pos(), list: body},
+			elseif: when,
+		}
+	}
+	when.flow(g)
+	g.nextStep(end)
+	return head
+}
+
+// receivedChannel returns the channel of a receive operation ; or nil if the expression is not one.
+func receivedChannel(x Expr) Expr {
+	if paren, ok := x.(ParenExpr); ok {
+		return receivedChannel(paren.x)
+	}
+	if unary, ok := x.(UnaryExpr); ok && unary.op == token.ARROW {
+		return unary.x
+	}
+	return nil
 }
+
 func (s SelectStmt) stmtStep() Evaluable { return s }
 
 func (s SelectStmt) pos() token.Pos {
 	return s.selectPos
 }
+
+func (s SelectStmt) String() string {
+	return fmt.Sprintf("SelectStmt(%v)", s.body)
+}
+
+var _ Flowable = CommClause{}
+
+// A CommClause represents a case of a select statement.
+type CommClause struct {
+	casePos token.Pos // position of "case" or "default" keyword
+	comm    Stmt      // send or receive statement; nil means default case
+	body    []Stmt
+}
+
+func (c CommClause) eval(vm *VM) {}
+
+func (c CommClause) flow(g *graphBuilder) (head Step) {
+	// no flow for comm clause itself; see SelectStmt
+	return nil
+}
+
+func (c CommClause) pos() token.Pos { return c.casePos }
+
+func (c CommClause) stmtStep() Evaluable { return c }
+
+func (c CommClause) String() string {
+	return fmt.Sprintf("CommClause(%v,%v)", c.comm, c.body)
+}
@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"io"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -57,20 +59,317 @@ func TestMakeChanUserWriteRead(t *testing.T) {
 }
 
 func TestSelect(t *testing.T) {
-	t.Skip()
 	testMain(t, `package main
 func main() {
-    c1 := make(chan string,1)
-    c2 := make(chan string,1)
-    c1 <- "one"
-    c2 <- "two"
+    c1 := make(chan int,1)
+    c2 := make(chan int,1)
+    c1 <- 1
+    c2 <- 2
+    sum := 0
     for range 2 {
         select {
-        case msg1 := <-c1:
-            print(msg1)
-        case msg2 := <-c2:
-            print(msg2)
+        case v1 := <-c1:
+            sum += v1
+        case v2 := <-c2:
+            sum += v2
         }
     }
-}`, "onetwo")
+    print(sum)
+}`, "3")
+}
+
+func TestSelectDefault(t *testing.T) {
+	testMain(t, `package main
+func main() {
+    c := make(chan int)
+    select {
+    case v := <-c:
+        print(v)
+    default:
+        print("none")
+    }
+}`, "none")
+}
+
+func TestSelectReceiveClosed(t *testing.T) {
+	testMain(t, `package main
+func main() {
+    c := make(chan int)
+    close(c)
+    select {
+    case v, ok := <-c:
+        print(v, ok)
+    }
+}`, "0false")
+}
+
+func TestSelectWaitsForRoutines(t *testing.T) {
+	testMain(t, `package main
+
+import "fmt"
+
+func main() {
+    in := make(chan int)
+    out := make(chan string)
+    quit := make(chan bool)
+    go func() {
+        out <- fmt.Sprint(<-in)
+        quit <- true
+    }()
+    for {
+        select {
+        case in <- 1:
+            print("sent")
+        case s := <-out:
+            print(s)
+        case <-quit:
+            print("quit")
+            return
+        }
+    }
+}`, "sent1quit")
+}
+
+func TestSelectBreak(t *testing.T) {
+	testMain(t, `package main
+func main() {
+    c := make(chan int, 1)
+    for i := range 2 {
+        c <- i
+        select {
+        case v := <-c:
+            if v == 0 {
+                break
+            }
+            print(v)
+        }
+        print("-")
+    }
+}`, "-1-")
+}
+
+func TestGoDeadlockSelectNoCases(t *testing.T) {
+	err := runUntilError(t, `package main
+
+func main() {
+	select {}
+}`)
+	if _, ok := err.(DeadlockError); !ok {
+		t.Fatalf("expected deadlock, got %v", err)
+	}
+	if got, want := withoutDirs(err.Error()), "goroutine 1 [select (no cases)]:\nmain.main(...)\n\tmain.go:4\n"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+}
+
+func TestGoDeadlockSelect(t *testing.T) {
+	err := runUntilError(t, `package main
+
+func main() {
+	c1 := make(chan int)
+	c2 := make(chan int)
+	select {
+	case <-c1:
+	case c2 <- 1:
+	}
+}`)
+	if _, ok := err.(DeadlockError); !ok {
+		t.Fatalf("expected deadlock, got %v", err)
+	}
+	if got, want := withoutDirs(err.Error()), "goroutine 1 [select]:\nmain.main(...)\n\tmain.go:6\n"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+}
+
+func TestGoUnbufferedChan(t *testing.T) {
+	testMain(t, `package main
+
+func produce(c chan int) {
+	for i := range 3 {
+		c <- i
+	}
+}
+func main() {
+	c := make(chan int)
+	go produce(c)
+	for range 3 {
+		print(<-c)
+	}
+}`, "012")
+}
+
+func TestGoFuncLitClosure(t *testing.T) {
+	testMain(t, `package main
+
+func main() {
+	done := make(chan bool)
+	msg := "gi"
+	go func() {
+		print(msg)
+		done <- true
+	}()
+	<-done
+}`, "gi")
+}
+
+func TestGoWaitGroup(t *testing.T) {
+	testMain(t, `package main
+
+import "sync"
+
+func main() {
+	wg := new(sync.WaitGroup)
+	mu := new(sync.Mutex)
+	sum := 0
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			mu.Lock()
+			sum += i
+			mu.Unlock()
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	print(sum)
+}`, "6")
+}
+
+func TestGoWaitGroupValue(t *testing.T) {
+	testMain(t, `package main
+
+import "sync"
+
+func main() {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sum := 0
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			sum += i
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	print(sum)
+}`, "6")
+}
+
+func TestGoSleepDoesNotBlockOthers(t *testing.T) {
+	testMain(t, `package main
+
+import "time"
+
+func main() {
+	c := make(chan string)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c <- "slow"
+	}()
+	go func() {
+		c <- "fast"
+	}()
+	print(<-c)
+	print(<-c)
+}`, "fastslow")
+}
+
+func TestGoMethod(t *testing.T) {
+	testMain(t, `package main
+
+type Greeter struct{ name string }
+
+func (g Greeter) greet(c chan string, suffix string) {
+	c <- g.name + suffix
+}
+func main() {
+	c := make(chan string)
+	g := Greeter{name: "gi"}
+	go g.greet(c, "!")
+	print(<-c)
+}`, "gi!")
+}
+
+func runUntilError(t *testing.T, source string) error {
+	t.Helper()
+	vm := NewVM(buildPackage(t, source))
+	vm.launch("main", nil)
+	for {
+		if err := vm.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// withoutDirs removes the (temporary) directories from the positions in a goroutine dump.
+func withoutDirs(dump string) string {
+	return regexp.MustCompile(`\t\S*/`).ReplaceAllString(dump, "\t")
+}
+
+func TestGoDeadlockReceive(t *testing.T) {
+	err := runUntilError(t, `package main
+
+func main() {
+	c := make(chan int)
+	go func() {
+		c <- 1
+	}()
+	<-c
+	<-c
+}`)
+	if _, ok := err.(DeadlockError); !ok {
+		t.Fatalf("expected deadlock, got %v", err)
+	}
+	if got, want := withoutDirs(err.Error()), "goroutine 1 [chan receive]:\nmain.main(...)\n\tmain.go:9\n"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+}
+
+func TestGoDeadlockWaitGroup(t *testing.T) {
+	err := runUntilError(t, `package main
+
+import "sync"
+
+func worker(c chan int) {
+	<-c
+}
+func main() {
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	c := make(chan int)
+	go worker(c)
+	wg.Wait()
+}`)
+	if _, ok := err.(DeadlockError); !ok {
+		t.Fatalf("expected deadlock, got %v", err)
+	}
+	for _, want := range []string{
+		"goroutine 1 [sync.WaitGroup.Wait]:\nmain.main(...)\n\tmain.go:13\n",
+		"goroutine 2 [chan receive]:\nmain.worker(...)\n\tmain.go:6\ncreated by main.main in goroutine 1\n\tmain.go:12\n",
+	} {
+		if got := withoutDirs(err.Error()); !strings.Contains(got, want) {
+			t.Errorf("got %q want to contain %q", got, want)
+		}
+	}
+}
+
+func TestGoNoDeadlockWhileSleeping(t *testing.T) {
+	testMain(t, `package main
+
+import "time"
+
+func main() {
+	c := make(chan int)
+	go func() {
+		time.Sleep(time.Millisecond)
+		c <- 1
+	}()
+	print(<-c)
+}`, "1")
 }
@@ -0,0 +1,249 @@
+package dap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/emicklei/gi/pkg"
+	"github.com/google/go-dap"
+)
+
+// Host lets a client attach to the interpreter that is embedded in a process, such as a service that
+// runs scripts with gi.Call. Functions called through the host while a client is attached can be debugged:
+// each call is a thread and the breakpoints of the client are set in it. Otherwise they run as with gi.Call.
+//
+//	host := &dap.Host{Addr: "127.0.0.1:52951"}
+//	if err := host.Listen(); err != nil { ... }
+//	defer host.Close()
+//	results, err := host.Call(p, "Handle", request)
+type Host struct {
+	Addr string
+	// Options configure the VM of each call
+	Options []pkg.VMOption
+
+	mutex    sync.Mutex
+	listener net.Listener
+	// the session of the attached client ; nil if none
+	session     *session
+	threadIdSeq int
+}
+
+// attachedThread is a function called by the host while a client is attached.
+type attachedThread struct {
+	id   int
+	name string
+	vma  *pkg.DAPAccess
+	// receives the error that ended the run, io.EOF if the function has returned
+	done chan error
+	// closed when the client has gone while the function was not running
+	released chan struct{}
+}
+
+// Listen starts listening on the address of the host and serves the connections of clients, one at a time,
+// in the background.
+func (h *Host) Listen() error {
+	listener, err := net.Listen("tcp", h.Addr)
+	if err != nil {
+		return err
+	}
+	log.Println("DAP host listening at:", listener.Addr())
+	h.mutex.Lock()
+	h.listener = listener
+	h.mutex.Unlock()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Println("Connection failed:", err)
+				return
+			}
+			log.Println("Accepted connection from", conn.RemoteAddr())
+			if err := serveSession(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), h); err != nil {
+				log.Println("Session failed:", err)
+			}
+			log.Println("Closing connection from", conn.RemoteAddr())
+			conn.Close()
+		}
+	}()
+	return nil
+}
+
+// Close stops listening. A client that is attached stays attached until it disconnects.
+func (h *Host) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.listener == nil {
+		return nil
+	}
+	return h.listener.Close()
+}
+
+// Call calls a function named funcName in the given package with the provided parameter values
+// and returns its results. If a client is attached, the call blocks while the function is stopped.
+func (h *Host) Call(p *pkg.Package, funcName string, params ...any) ([]any, error) {
+	h.mutex.Lock()
+	ds := h.session
+	h.threadIdSeq++
+	id := h.threadIdSeq
+	h.mutex.Unlock()
+	if ds == nil {
+		return pkg.CallPackageFunction(p, funcName, params, h.Options...)
+	}
+	vma := pkg.NewDAPAccess(pkg.NewVM(p, h.Options...))
+	vma.Launch(funcName, params)
+	t := &attachedThread{
+		id:       id,
+		name:     fmt.Sprintf("%s.%s #%d", p.Name, funcName, id),
+		vma:      vma,
+		done:     make(chan error, 1),
+		released: make(chan struct{}),
+	}
+	if !ds.adopt(t) {
+		return runToEnd(vma)
+	}
+	ds.doContinue(vma)
+	ds.attachWg.Done()
+	select {
+	case err := <-t.done:
+		return resultsOf(vma, err)
+	case <-t.released:
+		return runToEnd(vma)
+	}
+}
+
+// runToEnd runs a launched function that has no breakpoints until it has returned.
+func runToEnd(vma *pkg.DAPAccess) ([]any, error) {
+	for {
+		if _, err := vma.Continue(func() bool { return false }); err != nil {
+			return resultsOf(vma, err)
+		}
+	}
+}
+
+// resultsOf returns the results of a function if its run has ended without error.
+func resultsOf(vma *pkg.DAPAccess, err error) ([]any, error) {
+	if err != io.EOF {
+		return nil, fmt.Errorf("error during execution: %v", err)
+	}
+	return vma.Results(), nil
+}
+
+// attach makes the session the one of the attached client of its host.
+func (ds *session) attach() error {
+	if ds.host == nil {
+		return fmt.Errorf("attach is only supported by a process that embeds a dap.Host")
+	}
+	ds.host.mutex.Lock()
+	defer ds.host.mutex.Unlock()
+	if ds.host.session != nil && ds.host.session != ds {
+		return fmt.Errorf("another client is attached")
+	}
+	ds.host.session = ds
+	return nil
+}
+
+// detach ends debugging calls of the host by the session. Functions that are called later run as usual.
+func (ds *session) detach() {
+	if ds.host == nil {
+		return
+	}
+	ds.host.mutex.Lock()
+	if ds.host.session == ds {
+		ds.host.session = nil
+	}
+	ds.host.mutex.Unlock()
+}
+
+// adopt makes a function called by the host a thread of the session and sets the breakpoints of the session.
+// It returns false if the session has ended ; otherwise the caller must call attachWg.Done when it has stopped
+// running the function.
+func (ds *session) adopt(t *attachedThread) bool {
+	ds.mutex.Lock()
+	ds.threadsMutex.Lock()
+	if ds.closed {
+		ds.threadsMutex.Unlock()
+		ds.mutex.Unlock()
+		return false
+	}
+	ds.attachWg.Add(1)
+	if ds.threads == nil {
+		ds.threads = map[int]*attachedThread{}
+	}
+	ds.threads[t.id] = t
+	t.vma.Log = ds.sendConsoleOutput
+	t.vma.SetExceptionBreakMode(ds.exceptionBreak)
+	for path, each := range ds.breakpoints {
+		t.vma.SetBreakpoints(path, each)
+	}
+	t.vma.SetFunctionBreakpoints(ds.functionBreakpoints)
+	ds.threadsMutex.Unlock()
+	ds.mutex.Unlock()
+	ds.sendThreadEvent(t.id, "started")
+	return true
+}
+
+// release lets the functions of the threads that are stopped run to their end without the session.
+// The session must be closed and the functions that were running must have stopped.
+func (ds *session) release() {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	ds.threadsMutex.Lock()
+	defer ds.threadsMutex.Unlock()
+	for _, t := range ds.threads {
+		for path := range ds.breakpoints {
+			t.vma.SetBreakpoints(path, nil)
+		}
+		t.vma.SetFunctionBreakpoints(nil)
+		t.vma.SetExceptionBreakMode(pkg.BreakOnNoPanics)
+		t.vma.Log = nil
+		close(t.released)
+	}
+	clear(ds.threads)
+}
+
+// threadOf returns the attached thread of a program ; nil if the program is not called by the host.
+func (ds *session) threadOf(vma *pkg.DAPAccess) *attachedThread {
+	ds.threadsMutex.Lock()
+	defer ds.threadsMutex.Unlock()
+	for _, t := range ds.threads {
+		if t.vma == vma {
+			return t
+		}
+	}
+	return nil
+}
+
+// endThread notifies the client and the caller of the function of a thread that it has ended.
+func (ds *session) endThread(t *attachedThread, err error) {
+	ds.threadsMutex.Lock()
+	delete(ds.threads, t.id)
+	ds.threadsMutex.Unlock()
+	if err != io.EOF {
+		log.Println("program failed:", err)
+	}
+	ds.sendThreadEvent(t.id, "exited")
+	t.done <- err
+}
+
+// attachedThreads returns the threads of the functions called by the host, ordered by id.
+func (ds *session) attachedThreads() (threads []dap.Thread) {
+	ds.threadsMutex.Lock()
+	defer ds.threadsMutex.Unlock()
+	for _, t := range ds.threads {
+		threads = append(threads, dap.Thread{Id: t.id, Name: t.name})
+	}
+	slices.SortFunc(threads, func(a, b dap.Thread) int { return a.Id - b.Id })
+	return
+}
+
+func (ds *session) sendThreadEvent(id int, reason string) {
+	e := &dap.ThreadEvent{Event: *newEvent("thread")}
+	e.Body.Reason = reason
+	e.Body.ThreadId = id
+	ds.send(e)
+}
@@ -0,0 +1,188 @@
+package dap
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emicklei/gi/pkg"
+	"github.com/google/go-dap"
+)
+
+const scriptSource = `package script
+
+func Handle(n int) int {
+	sum := 0
+	for i := range n {
+		sum += i
+	}
+	return sum
+}
+`
+
+// newHost returns a listening host and a script package built from disk with the path of its source file.
+func newHost(t *testing.T) (*Host, *pkg.Package, string) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.go")
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module script\n\ngo 1.24\n"), 0644)
+	os.WriteFile(path, []byte(scriptSource), 0644)
+	gopkg, err := pkg.LoadPackage(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pkg.BuildPackage(gopkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := &Host{Addr: "127.0.0.1:0"}
+	if err := host.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { host.Close() })
+	return host, p, path
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// attachTo connects to the host and attaches with a breakpoint on a line of the script.
+func attachTo(t *testing.T, host *Host, path string, line int) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", host.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{conn: conn, r: bufio.NewReader(conn)}
+	c.send(&dap.InitializeRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 1, Type: "request"}, Command: "initialize"}})
+	expect[*dap.InitializeResponse](t, c)
+	c.send(&dap.AttachRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 2, Type: "request"}, Command: "attach"}})
+	expect[*dap.AttachResponse](t, c)
+	c.send(&dap.SetBreakpointsRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 3, Type: "request"}, Command: "setBreakpoints"},
+		Arguments: dap.SetBreakpointsArguments{Source: dap.Source{Path: path}, Breakpoints: []dap.SourceBreakpoint{{Line: line}}}})
+	expect[*dap.SetBreakpointsResponse](t, c)
+	c.send(&dap.ConfigurationDoneRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 4, Type: "request"}, Command: "configurationDone"}})
+	expect[*dap.ConfigurationDoneResponse](t, c)
+	return c
+}
+
+func (c *testClient) send(m dap.Message) {
+	dap.WriteProtocolMessage(c.conn, m)
+}
+
+// expect returns the next message of a type, skipping others.
+func expect[T dap.Message](t *testing.T, c *testClient) T {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		m, err := dap.ReadProtocolMessage(c.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if each, ok := m.(T); ok {
+			return each
+		}
+	}
+}
+
+type callResult struct {
+	results []any
+	err     error
+}
+
+func call(host *Host, p *pkg.Package, n int) chan callResult {
+	done := make(chan callResult, 1)
+	go func() {
+		results, err := host.Call(p, "Handle", n)
+		done <- callResult{results, err}
+	}()
+	return done
+}
+
+func result(t *testing.T, done chan callResult) any {
+	t.Helper()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		return r.results[0]
+	case <-time.After(5 * time.Second):
+		t.Fatal("call did not return")
+		return nil
+	}
+}
+
+func TestHostCallWithoutClient(t *testing.T) {
+	host, p, _ := newHost(t)
+	if got, want := result(t, call(host, p, 4)), 6; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestAttachToHost(t *testing.T) {
+	host, p, path := newHost(t)
+	c := attachTo(t, host, path, 8)
+	defer c.conn.Close()
+
+	done := call(host, p, 5)
+	started := expect[*dap.ThreadEvent](t, c)
+	stopped := expect[*dap.StoppedEvent](t, c)
+	if got, want := stopped.Body.ThreadId, started.Body.ThreadId; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	c.send(&dap.ThreadsRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 5, Type: "request"}, Command: "threads"}})
+	threads := expect[*dap.ThreadsResponse](t, c)
+	if got, want := len(threads.Body.Threads), 1; got != want {
+		t.Fatalf("got %d want %d", got, want)
+	}
+	if got, want := threads.Body.Threads[0].Name, "script.Handle #"; got[:len(want)] != want {
+		t.Errorf("got %q want prefix %q", got, want)
+	}
+	c.send(&dap.StackTraceRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 6, Type: "request"}, Command: "stackTrace"},
+		Arguments: dap.StackTraceArguments{ThreadId: stopped.Body.ThreadId}})
+	frames := expect[*dap.StackTraceResponse](t, c)
+	if len(frames.Body.StackFrames) == 0 || frames.Body.StackFrames[0].Source.Path != path {
+		t.Fatalf("unexpected frames %#v", frames.Body.StackFrames)
+	}
+	c.send(&dap.ContinueRequest{Request: dap.Request{ProtocolMessage: dap.ProtocolMessage{Seq: 7, Type: "request"}, Command: "continue"},
+		Arguments: dap.ContinueArguments{ThreadId: stopped.Body.ThreadId}})
+	expect[*dap.ContinueResponse](t, c)
+	if exited := expect[*dap.ThreadEvent](t, c); exited.Body.Reason != "exited" {
+		t.Errorf("got %q want exited", exited.Body.Reason)
+	}
+	if got, want := result(t, done), 10; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestDetachReleasesStoppedCall(t *testing.T) {
+	host, p, path := newHost(t)
+	c := attachTo(t, host, path, 6)
+	done := call(host, p, 5)
+	expect[*dap.StoppedEvent](t, c)
+	c.conn.Close()
+	if got, want := result(t, done), 10; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+	// no client is attached
+	if got, want := result(t, call(host, p, 3)), 3; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestAttachWithoutHost(t *testing.T) {
+	ds := &session{sendQueue: make(chan dap.Message, 16)}
+	ds.onAttachRequest(&dap.AttachRequest{Request: dap.Request{Command: "attach"}})
+	if resp, ok := receive(t, ds).(*dap.ErrorResponse); !ok || resp.Success {
+		t.Fatal("expected error response")
+	}
+}
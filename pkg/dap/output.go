@@ -0,0 +1,70 @@
+package dap
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/google/go-dap"
+)
+
+// programOutput streams what a program writes to its stdout and stderr to the client as output events.
+type programOutput struct {
+	// write ends of the pipes, given to the VM
+	stdout, stderr *os.File
+	done           sync.WaitGroup
+	closeOnce      sync.Once
+}
+
+// newProgramOutput returns the output of a program that is sent by the session.
+func (ds *session) newProgramOutput() (*programOutput, error) {
+	o := new(programOutput)
+	for _, each := range []struct {
+		category string
+		file     **os.File
+	}{{"stdout", &o.stdout}, {"stderr", &o.stderr}} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			o.close()
+			return nil, err
+		}
+		*each.file = w
+		o.done.Add(1)
+		go ds.sendOutput(r, each.category, &o.done)
+	}
+	return o, nil
+}
+
+// sendOutput sends what is read from r as output events of a category until r is closed by the writer.
+func (ds *session) sendOutput(r *os.File, category string, done *sync.WaitGroup) {
+	defer done.Done()
+	defer r.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			e := &dap.OutputEvent{Event: *newEvent("output")}
+			e.Body.Category = category
+			e.Body.Output = string(buf[:n])
+			ds.send(e)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// close closes the write ends and waits until all output is sent.
+func (o *programOutput) close() {
+	o.closeOnce.Do(func() {
+		for _, each := range []*os.File{o.stdout, o.stderr} {
+			if each == nil {
+				continue
+			}
+			if err := each.Close(); err != nil {
+				log.Println("closing program output failed:", err)
+			}
+		}
+		o.done.Wait()
+	})
+}
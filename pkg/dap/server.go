@@ -31,19 +31,15 @@ type Server struct {
 }
 
 // Starts a server that listens on a specified port
-// and blocks indefinitely. This server can accept multiple
-// client connections at the same time.
+// and blocks until the session of the first client
+// connection has ended.
 func (s *Server) Start() error {
-	listener, err := net.Listen("tcp", s.Addr)
+	listener, err := s.listen()
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
 
-	// Line must start with "DAP server listening at:"
-	// see https://github.com/golang/vscode-go/blob/f907536117c3e9fc731be9277e992b8cc7cd74f1/extension/src/goDebugFactory.ts#L558
-	fmt.Println("DAP server listening at:", s.Addr)
-
 	// single session
 	conn, err := listener.Accept()
 	if err != nil {
@@ -51,41 +47,101 @@ func (s *Server) Start() error {
 		return err
 	}
 	log.Println("Accepted connection from", conn.RemoteAddr())
-	// Handle multiple client connections concurrently
-	s.handleConnection(conn)
-	return nil
+	return s.handleConnection(conn)
+}
+
+// Serve starts a server that listens on a specified port
+// and blocks indefinitely. Each client connection has its own
+// session, with its own program, and connections are served
+// at the same time.
+func (s *Server) Serve() error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("Connection failed:", err)
+			return err
+		}
+		log.Println("Accepted connection from", conn.RemoteAddr())
+		go func() {
+			if err := s.handleConnection(conn); err != nil {
+				log.Println("Session failed:", err)
+			}
+		}()
+	}
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	// Line must start with "DAP server listening at:"
+	// see https://github.com/golang/vscode-go/blob/f907536117c3e9fc731be9277e992b8cc7cd74f1/extension/src/goDebugFactory.ts#L558
+	fmt.Println("DAP server listening at:", s.Addr)
+	return listener, nil
+}
+
+// ServeStdio runs a single session that reads requests from r and writes
+// responses and events to w, such as stdin and stdout of the process.
+// It returns when r has no more data.
+func ServeStdio(r io.Reader, w io.Writer) error {
+	return serveSession(bufio.NewReadWriter(bufio.NewReader(r), bufio.NewWriter(w)), nil)
 }
 
 // handleConnection handles a connection from a single client.
+func (s *Server) handleConnection(conn net.Conn) error {
+	defer conn.Close()
+	err := serveSession(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil)
+	log.Println("Closing connection from", conn.RemoteAddr())
+	return err
+}
+
+// serveSession runs a session for a single client.
 // It reads and decodes the incoming data and dispatches it
 // to per-request processing goroutines. It also launches the
-// sender goroutine to send resulting messages over the connection
-// back to the client.
-func (s *Server) handleConnection(conn net.Conn) {
+// sender goroutine to send resulting messages
+// back to the client. The host is set if the client can attach to it.
+func serveSession(rw *bufio.ReadWriter, host *Host) error {
 	session := &session{
-		rw:           bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+		rw:           rw,
 		sendQueue:    make(chan dap.Message),
 		stopStepping: make(chan struct{}),
+		host:         host,
 	}
 	go session.sendFromQueue()
 
+	var err error
 	for {
-		err := session.handleRequest()
+		err = session.handleRequest()
 		if err != nil {
 			if err == io.EOF {
 				log.Println("No more data to read:", err)
-				break
+				err = nil
 			}
 			// There maybe more messages to process, but
 			// we will start with the strict behavior of only accepting
 			// expected inputs.
-			log.Fatal("Server error: ", err)
+			break
 		}
 	}
 
-	log.Println("Closing connection from", conn.RemoteAddr())
 	close(session.stopStepping)
+	session.detach()
 	session.sendWg.Wait()
+	// functions called by the host are stopped or have ended
+	session.threadsMutex.Lock()
+	session.closed = true
+	session.threadsMutex.Unlock()
+	session.attachWg.Wait()
+	session.release()
+	if session.output != nil {
+		session.output.close()
+	}
 	close(session.sendQueue)
-	conn.Close()
+	return err
 }
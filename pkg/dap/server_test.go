@@ -23,6 +23,8 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -33,7 +35,7 @@ import (
 var (
 	initializeRequest  = []byte(`{"seq":1,"type":"request","command":"initialize","arguments":{"clientID":"vscode","clientName":"Visual Studio Code","adapterID":"go","pathFormat":"path","linesStartAt1":true,"columnsStartAt1":true,"supportsVariableType":true,"supportsVariablePaging":true,"supportsRunInTerminalRequest":true,"locale":"en-us"}}`)
 	initializedEvent   = []byte(`{"seq":0,"type":"event","event":"initialized"}`)
-	initializeResponse = []byte(`{"seq":0,"type":"response","request_seq":1,"success":true,"command":"initialize","body":{"supportsConfigurationDoneRequest":true}}`)
+	initializeResponse = []byte(`{"seq":0,"type":"response","request_seq":1,"success":true,"command":"initialize","body":{"supportsConfigurationDoneRequest":true,"supportsFunctionBreakpoints":true,"supportsConditionalBreakpoints":true,"supportsHitConditionalBreakpoints":true,"supportsEvaluateForHovers":true,"exceptionBreakpointFilters":[{"filter":"all","label":"All panics"},{"filter":"uncaught","label":"Uncaught panics","default":true}],"supportsRestartFrame":true,"supportsGotoTargetsRequest":true,"supportsStepInTargetsRequest":true,"supportsCompletionsRequest":true,"completionTriggerCharacters":["."],"supportsRestartRequest":true,"supportsExceptionInfoRequest":true,"supportsLoadedSourcesRequest":true,"supportsLogPoints":true,"supportsDataBreakpoints":true,"supportsDisassembleRequest":true,"supportsBreakpointLocationsRequest":true,"supportsSteppingGranularity":true}}`)
 )
 
 func TestServer(t *testing.T) {
@@ -55,6 +57,100 @@ func TestServer(t *testing.T) {
 	wg.Wait()
 }
 
+func TestServeStdio(t *testing.T) {
+	log.SetOutput(io.Discard)
+	requests, in := io.Pipe()
+	out, responses := io.Pipe()
+	done := make(chan error)
+	go func() { done <- ServeStdio(requests, responses) }()
+
+	r := bufio.NewReader(out)
+	dap.WriteBaseMessage(in, initializeRequest)
+	expectMessage(t, r, initializedEvent)
+	expectMessage(t, r, initializeResponse)
+	in.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not end")
+	}
+}
+
+func TestServeStdioFatalError(t *testing.T) {
+	log.SetOutput(io.Discard)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module fatal\n\ngo 1.24\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(`package main
+
+func main() {
+	var p *int
+	x := 1
+	print(*p + x)
+}`), 0644)
+	// the protocol is written to stdout, as by gi dap --stdio
+	requests, in := io.Pipe()
+	out, responses, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = responses
+	defer func() { os.Stdout = stdout }()
+	go ServeStdio(requests, responses)
+
+	r := bufio.NewReader(out)
+	dap.WriteBaseMessage(in, initializeRequest)
+	expectMessage(t, r, initializedEvent)
+	expectMessage(t, r, initializeResponse)
+	dap.WriteBaseMessage(in, []byte(`{"seq":2,"type":"request","command":"launch","arguments":{"program":"`+dir+`"}}`))
+	dap.WriteBaseMessage(in, []byte(`{"seq":3,"type":"request","command":"configurationDone"}`))
+	for {
+		m, err := dap.ReadProtocolMessage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.(*dap.TerminatedEvent); ok {
+			break
+		}
+	}
+	in.Close()
+}
+
+func TestServeMultipleSessions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	port := "9998"
+	go func() {
+		srv := Server{Addr: ":" + port}
+		if err := srv.Serve(); err != nil {
+			log.Fatal("Could not start server:", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the second session starts while the first is still connected
+	var first, second sync.WaitGroup
+	first.Add(1)
+	second.Add(1)
+	conn, err := net.Dial("tcp", ":"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go client(t, port, &second)
+	second.Wait()
+	go func() {
+		defer first.Done()
+		r := bufio.NewReader(conn)
+		dap.WriteBaseMessage(conn, initializeRequest)
+		expectMessage(t, r, initializedEvent)
+		expectMessage(t, r, initializeResponse)
+	}()
+	first.Wait()
+}
+
 func client(t *testing.T, port string, wg *sync.WaitGroup) {
 	defer wg.Done()
 	conn, err := net.Dial("tcp", ":"+port)
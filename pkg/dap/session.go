@@ -19,11 +19,15 @@ package dap
 
 import (
 	"bufio"
+	"cmp"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/emicklei/gi/pkg"
 	"github.com/google/go-dap"
@@ -49,13 +53,50 @@ type session struct {
 	// stopStepping is used to notify long-running handlers to stop processing.
 	stopStepping chan struct{}
 
-	// bpSet is a counter of the remaining breakpoints that the debug
-	// session is yet to stop at before the program terminates.
-	bpSet    int
-	bpSetMux sync.Mutex
+	// pauseRequested is set by a pause request and checked between steps while the program runs.
+	pauseRequested atomic.Bool
+	// running is held while a continue loop runs the program ; a restart waits for the loop to stop
+	running    sync.Mutex
+	restarting atomic.Bool
 
-	// vma represents program being debugged
+	// mutex guards the fields that follow up to vma because requests are handled concurrently ; it is locked before threadsMutex
+	mutex sync.Mutex
+
+	// exceptionBreak is set by the exception breakpoints request and applied at launch
+	exceptionBreak pkg.ExceptionBreakMode
+
+	// breakpoints by source path, set by the breakpoints request and applied at launch
+	breakpoints         map[string][]*pkg.Breakpoint
+	functionBreakpoints []*pkg.Breakpoint
+	breakpointIdSeq     int
+
+	// launchArguments are the configuration of the launch request, used by the restart request
+	launchArguments json.RawMessage
+	// set by the launch configuration
+	stopOnEntry bool
+	noDebug     bool
+	recording   bool
+	// of the launched program ; nil if the program was not launched by the session
+	output *programOutput
+
+	// vma represents program being debugged, see program and selectProgram
 	vma *pkg.DAPAccess
+
+	// the program starts running when both the launch and configuration done requests are handled
+	startMutex sync.Mutex
+	launched   bool
+	configured bool
+	started    bool
+
+	// host is set if the client can attach to the process that embeds gi ; see Host
+	host *Host
+	// functions called by the host while attached, by thread id
+	threadsMutex sync.Mutex
+	threads      map[int]*attachedThread
+	// set when the session has ended ; no more functions are adopted
+	closed bool
+	// counts the functions that are run by their callers while attached
+	attachWg sync.WaitGroup
 }
 
 func (ds *session) handleRequest() error {
@@ -90,26 +131,95 @@ func (ds *session) sendFromQueue() {
 	}
 }
 
-// TODO make it work
-func (ds *session) doContinue() {
-	var e dap.Message
-	ds.bpSetMux.Lock()
-	if ds.bpSet == 0 {
-		// Pretend that the program is running.
-		// The delay will allow for all in-flight responses
-		// to be sent before termination.
-		time.Sleep(1000 * time.Millisecond)
-		e = &dap.TerminatedEvent{
-			Event: *newEvent("terminated"),
-		}
-	} else {
-		e = &dap.StoppedEvent{
-			Event: *newEvent("stopped"),
-			Body:  dap.StoppedEventBody{Reason: "breakpoint", ThreadId: 1, AllThreadsStopped: true},
-		}
-		ds.bpSet--
+// doContinue runs the program until it is paused or has ended.
+// It is called from the goroutine that handles the continue request.
+func (ds *session) doContinue(vma *pkg.DAPAccess) {
+	ds.running.Lock()
+	defer ds.running.Unlock()
+	ds.pauseRequested.Store(false)
+	reason, err := vma.Continue(ds.isPaused)
+	if ds.restarting.Load() {
+		// the restarted program is reported instead
+		return
+	}
+	if err != nil {
+		ds.terminate(vma, err)
+		return
+	}
+	ds.sendStopped(vma, reason)
+}
+
+// terminate sends the remaining output of the program and the exited and terminated events.
+// The exit code is that of os.Exit if called or 2 if the program failed by a panic, as with the Go SDK.
+func (ds *session) terminate(vma *pkg.DAPAccess, err error) {
+	if t := ds.threadOf(vma); t != nil {
+		ds.endThread(t, err)
+		return
+	}
+	code := vma.ExitCode()
+	if err != io.EOF {
+		log.Println("program failed:", err)
+		code = 2
+	}
+	ds.mutex.Lock()
+	if ds.output != nil && ds.vma == vma {
+		ds.output.close()
+	}
+	ds.mutex.Unlock()
+	exited := &dap.ExitedEvent{Event: *newEvent("exited")}
+	exited.Body.ExitCode = code
+	ds.send(exited)
+	ds.send(&dap.TerminatedEvent{Event: *newEvent("terminated")})
+}
+
+// doReverseContinue runs the program backwards until it is paused or the first recorded step is reached.
+// It is called from the goroutine that handles the reverse continue request.
+func (ds *session) doReverseContinue(vma *pkg.DAPAccess) {
+	ds.running.Lock()
+	defer ds.running.Unlock()
+	ds.pauseRequested.Store(false)
+	reason, err := vma.ReverseContinue(ds.isPaused)
+	if ds.restarting.Load() {
+		return
+	}
+	if err != nil {
+		log.Println("reverse continue failed:", err)
+		reason = "pause"
+	}
+	ds.sendStopped(vma, reason)
+}
+
+// isPaused returns whether a running program must stop because of a pause or restart request or the end of the session.
+func (ds *session) isPaused() bool {
+	select {
+	case <-ds.stopStepping:
+		return true
+	default:
+		return ds.pauseRequested.Load() || ds.restarting.Load()
+	}
+}
+
+// sendStopped notifies the client that the program has stopped in the goroutine that took the last step.
+func (ds *session) sendStopped(vma *pkg.DAPAccess, reason string) {
+	e := &dap.StoppedEvent{Event: *newEvent("stopped")}
+	e.Body.Reason = reason
+	e.Body.ThreadId = vma.CurrentThreadId()
+	e.Body.AllThreadsStopped = true
+	if t := ds.threadOf(vma); t != nil {
+		// other functions called by the host keep running
+		e.Body.ThreadId = t.id
+		e.Body.AllThreadsStopped = false
+		ds.selectProgram(vma)
+	}
+	if p := vma.ExceptionInfo(); reason == "exception" && p != nil {
+		e.Body.Description = "Paused on panic"
+		e.Body.Text = fmt.Sprint(p.Value)
+	}
+	if w := vma.DataWrite(); reason == "data breakpoint" && w != nil {
+		e.Body.Description = "Paused on data breakpoint"
+		e.Body.Text = w.Description()
+		e.Body.HitBreakpointIds = []int{w.Breakpoint.Id}
 	}
-	ds.bpSetMux.Unlock()
 	ds.send(e)
 }
 
@@ -117,37 +227,41 @@ func (ds *session) onInitializeRequest(request *dap.InitializeRequest) {
 	response := &dap.InitializeResponse{}
 	response.Response = *newResponse(request.Seq, request.Command)
 	response.Body.SupportsConfigurationDoneRequest = true
-	response.Body.SupportsFunctionBreakpoints = false
-	response.Body.SupportsConditionalBreakpoints = false
-	response.Body.SupportsHitConditionalBreakpoints = false
-	response.Body.SupportsEvaluateForHovers = false
-	response.Body.ExceptionBreakpointFilters = []dap.ExceptionBreakpointsFilter{}
-	response.Body.SupportsStepBack = false
+	response.Body.SupportsFunctionBreakpoints = true
+	response.Body.SupportsConditionalBreakpoints = true
+	response.Body.SupportsHitConditionalBreakpoints = true
+	response.Body.SupportsEvaluateForHovers = true
+	response.Body.ExceptionBreakpointFilters = []dap.ExceptionBreakpointsFilter{
+		{Filter: exceptionFilterAll, Label: "All panics"},
+		{Filter: exceptionFilterUncaught, Label: "Uncaught panics", Default: true},
+	}
+	// SupportsStepBack is sent with a capabilities event if the launched program records its steps
 	response.Body.SupportsSetVariable = false
-	response.Body.SupportsRestartFrame = false
-	response.Body.SupportsGotoTargetsRequest = false
-	response.Body.SupportsStepInTargetsRequest = false
-	response.Body.SupportsCompletionsRequest = false
-	response.Body.CompletionTriggerCharacters = []string{}
+	response.Body.SupportsRestartFrame = true
+	response.Body.SupportsGotoTargetsRequest = true
+	response.Body.SupportsStepInTargetsRequest = true
+	response.Body.SupportsCompletionsRequest = true
+	response.Body.CompletionTriggerCharacters = []string{"."}
 	response.Body.SupportsModulesRequest = false
 	response.Body.AdditionalModuleColumns = []dap.ColumnDescriptor{}
 	response.Body.SupportedChecksumAlgorithms = []dap.ChecksumAlgorithm{}
-	response.Body.SupportsRestartRequest = false
+	response.Body.SupportsRestartRequest = true
 	response.Body.SupportsExceptionOptions = false
 	response.Body.SupportsValueFormattingOptions = false
-	response.Body.SupportsExceptionInfoRequest = false
+	response.Body.SupportsExceptionInfoRequest = true
 	response.Body.SupportTerminateDebuggee = false
 	response.Body.SupportsDelayedStackTraceLoading = false
-	response.Body.SupportsLoadedSourcesRequest = false
-	response.Body.SupportsLogPoints = false
+	response.Body.SupportsLoadedSourcesRequest = true
+	response.Body.SupportsLogPoints = true
 	response.Body.SupportsTerminateThreadsRequest = false
 	response.Body.SupportsSetExpression = false
 	response.Body.SupportsTerminateRequest = false
-	response.Body.SupportsDataBreakpoints = false
+	response.Body.SupportsDataBreakpoints = true
 	response.Body.SupportsReadMemoryRequest = false
-	response.Body.SupportsDisassembleRequest = false
+	response.Body.SupportsDisassembleRequest = true
 	response.Body.SupportsCancelRequest = false
-	response.Body.SupportsBreakpointLocationsRequest = false
+	response.Body.SupportsBreakpointLocationsRequest = true
+	response.Body.SupportsSteppingGranularity = true
 	// Notify the client with an 'initialized' event. The client will end
 	// the configuration sequence with 'configurationDone' request.
 	e := &dap.InitializedEvent{Event: *newEvent("initialized")}
@@ -159,49 +273,248 @@ func (ds *session) onLaunchRequest(request *dap.LaunchRequest) {
 	resp := new(dap.LaunchResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
 	resp.Success = true
+	if err := ds.launch(request.Arguments); err != nil {
+		resp.Message = err.Error()
+		resp.Success = false
+		ds.send(resp)
+		return
+	}
+	ds.send(resp)
+	ds.sendStepBackCapability()
+	ds.start(func() { ds.launched = true })
+}
 
-	cwd, _ := os.Getwd()
-	log.Println("starting program in", cwd)
+// launchConfig holds the fields of a launch request.
+type launchConfig struct {
+	// directory or file of the main package ; default is cwd
+	Program string `json:"program"`
+	// command-line arguments of the program, os.Args[1:]
+	Args []string `json:"args"`
+	// environment variables to set for the program
+	Env map[string]string `json:"env"`
+	// working directory of the program ; default is the working directory of the server
+	Cwd         string `json:"cwd"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	// run the program to completion without stopping
+	NoDebug bool `json:"noDebug"`
 
-	gopkg, err := pkg.LoadPackage(cwd, nil)
+	// gi specific: what other goroutines do while stepping one of them, "freeze" (default) or "continue"
+	StepPolicy string `json:"stepPolicy"`
+	// gi specific: whether to record steps for stepping back, at most recordSteps if set
+	Record      bool `json:"record"`
+	RecordSteps int  `json:"recordSteps"`
+	// gi specific: the package function to launch instead of main, with a JSON array of its arguments
+	Function     string          `json:"function"`
+	FunctionArgs json.RawMessage `json:"functionArgs"`
+	// gi specific: whether to show the operand stack and the heap of the VM as scopes
+	ShowInternals bool `json:"showInternals"`
+}
+
+// launch loads and builds the package from disk and starts its main function, or the configured function, with the
+// configuration of the launch request and the breakpoints of the session. The arguments are kept for restarting.
+// Environment variables and the working directory are of the program only, see pkg.WithDir.
+func (ds *session) launch(arguments json.RawMessage) error {
+	var config launchConfig
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &config); err != nil {
+			return fmt.Errorf("invalid launch configuration: %w", err)
+		}
+	}
+	cwd, err := filepath.Abs(config.Cwd)
 	if err != nil {
-		log.Println("load package failed", err)
-		resp.Message = "failed to load package: " + err.Error()
-		resp.Success = false
-		ds.send(resp)
+		return fmt.Errorf("invalid working directory: %w", err)
+	}
+	program := config.Program
+	if program == "" {
+		program = cwd
+	} else if !filepath.IsAbs(program) {
+		program = filepath.Join(cwd, program)
+	}
+	dir := program
+	if info, err := os.Stat(program); err == nil && !info.IsDir() {
+		dir = filepath.Dir(program)
+	}
+	p, err := buildProgram(dir)
+	if err != nil {
+		return err
+	}
+	ds.mutex.Lock()
+	if ds.output != nil {
+		// of the program before restart
+		ds.output.close()
+		ds.output = nil
+	}
+	ds.mutex.Unlock()
+	output, err := ds.newProgramOutput()
+	if err != nil {
+		return fmt.Errorf("failed to capture program output: %w", err)
+	}
+	options := []pkg.VMOption{
+		pkg.WithArgs(append([]string{program}, config.Args...)...),
+		pkg.WithEnv(config.Env),
+		pkg.WithDir(cwd),
+		pkg.WithOutput(output.stdout, output.stderr),
+		pkg.WithOsExit(),
+	}
+	if config.Record && !config.NoDebug {
+		options = append(options, pkg.WithRecording(config.RecordSteps))
+	}
+	vma := pkg.NewDAPAccess(pkg.NewVM(p, options...))
+	if config.StepPolicy == "continue" {
+		vma.StepPolicy = pkg.ContinueOthers
+	}
+	vma.InternalScopes = config.ShowInternals
+	vma.Log = ds.sendConsoleOutput
+	if config.Function != "" {
+		if err := vma.LaunchWithJSON(config.Function, config.FunctionArgs); err != nil {
+			output.close()
+			return err
+		}
+	} else {
+		vma.Launch("main", nil)
+	}
+	// breakpoints that are set from here on are set in the launched program too
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	if !config.NoDebug {
+		vma.SetExceptionBreakMode(ds.exceptionBreak)
+		for path, each := range ds.breakpoints {
+			vma.SetBreakpoints(path, each)
+		}
+		vma.SetFunctionBreakpoints(ds.functionBreakpoints)
+	}
+	ds.launchArguments = arguments
+	ds.noDebug = config.NoDebug
+	ds.recording = config.Record && !config.NoDebug
+	ds.stopOnEntry = config.StopOnEntry && !config.NoDebug
+	ds.vma = vma
+	ds.output = output
+	return nil
+}
+
+// sendStepBackCapability tells the client that the launched program can step back if it records its steps.
+// This is not announced by the initialize response because it depends on the record setting of the launch.
+func (ds *session) sendStepBackCapability() {
+	ds.mutex.Lock()
+	recording := ds.recording
+	ds.mutex.Unlock()
+	if !recording {
 		return
 	}
+	e := &dap.CapabilitiesEvent{Event: *newEvent("capabilities")}
+	e.Body.Capabilities.SupportsStepBack = true
+	ds.send(e)
+}
+
+// buildProgram loads and builds the main package in dir.
+// Imported packages of the program are located by its module ; the working directory of the process is not changed.
+func buildProgram(dir string) (*pkg.Package, error) {
+	log.Println("starting program in", dir)
+
+	gopkg, err := pkg.LoadPackage(dir, nil)
+	if err != nil {
+		log.Println("load package failed", err)
+		return nil, fmt.Errorf("failed to load package: %w", err)
+	}
 	p, err := pkg.BuildPackage(gopkg)
 	if err != nil {
 		log.Println("build package failed", err)
-		resp.Message = "failed to build package: " + err.Error()
-		resp.Success = false
-		ds.send(resp)
+		return nil, fmt.Errorf("failed to build package: %w", err)
+	}
+	return p, nil
+}
+
+// start runs the launched program once the client has also sent the configuration done request.
+// The update records which of the two happened. The program stops on entry if configured.
+func (ds *session) start(update func()) {
+	ds.startMutex.Lock()
+	update()
+	ready := ds.launched && ds.configured && !ds.started
+	if ready {
+		ds.started = true
+	}
+	ds.startMutex.Unlock()
+	if ready {
+		ds.run(ds.program())
+	}
+}
+
+// run stops the program on entry if configured or else continues it.
+func (ds *session) run(vma *pkg.DAPAccess) {
+	ds.mutex.Lock()
+	stopOnEntry := ds.stopOnEntry
+	ds.mutex.Unlock()
+	if stopOnEntry {
+		ds.sendStopped(vma, "entry")
 		return
 	}
-	ds.vma = pkg.NewDAPAccess(pkg.NewVM(p))
-	ds.vma.Launch("main", nil)
-	ds.send(resp)
+	ds.doContinue(vma)
+}
 
-	// TODO simulate hit breakpoint
-	{
-		resp := &dap.StoppedEvent{}
-		resp.Body.Reason = "breakpoint"
-		resp.Body.ThreadId = 1
-		resp.Body.AllThreadsStopped = true
-		resp.Event = *newEvent("stopped")
-		ds.send(resp)
+// programs returns the programs in which breakpoints are set: the launched one, unless run without debugging,
+// or the functions called by the host while attached. The caller holds the mutex.
+func (ds *session) programs() (list []*pkg.DAPAccess) {
+	if ds.host != nil {
+		ds.threadsMutex.Lock()
+		defer ds.threadsMutex.Unlock()
+		for _, t := range ds.threads {
+			list = append(list, t.vma)
+		}
+		return
 	}
+	if ds.vma != nil && !ds.noDebug {
+		list = append(list, ds.vma)
+	}
+	return
+}
+
+// programOf returns the program of a thread and the id of the thread in that program.
+// While attached, the threads are the functions called by the host ; the program of the thread is selected
+// for the requests that follow, such as for scopes and variables.
+func (ds *session) programOf(threadId int) (*pkg.DAPAccess, int) {
+	if ds.host == nil {
+		return ds.program(), threadId
+	}
+	ds.threadsMutex.Lock()
+	t := ds.threads[threadId]
+	ds.threadsMutex.Unlock()
+	if t == nil {
+		return nil, 0
+	}
+	ds.selectProgram(t.vma)
+	return t.vma, t.vma.CurrentThreadId()
+}
+
+// program returns the program of the requests ; nil if no program is launched or selected.
+func (ds *session) program() *pkg.DAPAccess {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	return ds.vma
+}
 
+// selectProgram makes a program that of the requests that follow.
+func (ds *session) selectProgram(vma *pkg.DAPAccess) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	ds.vma = vma
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Attach
+// Functions called by the host are debugged once the configuration is done.
 func (ds *session) onAttachRequest(request *dap.AttachRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "AttachRequest is not yet supported"))
+	if ds.host == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "attach is only supported by a process that embeds a dap.Host"))
+		return
+	}
+	resp := new(dap.AttachResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.send(resp)
 }
 
 func (ds *session) onDisconnectRequest(request *dap.DisconnectRequest) {
 	// brutal
-	ds.vma = nil
+	ds.detach()
+	ds.selectProgram(nil)
 	resp := new(dap.DisconnectResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
 	resp.Success = true
@@ -210,52 +523,229 @@ func (ds *session) onDisconnectRequest(request *dap.DisconnectRequest) {
 
 func (ds *session) onTerminateRequest(request *dap.TerminateRequest) {
 	// brutal
-	ds.vma = nil
+	ds.selectProgram(nil)
 	resp := new(dap.TerminateResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
 	resp.Success = true
 	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Restart
 func (ds *session) onRestartRequest(request *dap.RestartRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "RestartRequest is not yet supported"))
+	ds.mutex.Lock()
+	launched, arguments := ds.vma != nil, ds.launchArguments
+	ds.mutex.Unlock()
+	if !launched {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	// the client can send the latest launch configuration
+	var restart struct {
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if json.Unmarshal(request.Arguments, &restart) == nil && len(restart.Arguments) > 0 {
+		arguments = restart.Arguments
+	}
+	// stop a running program and wait for it because launch closes its output
+	ds.restarting.Store(true)
+	ds.running.Lock()
+	err := ds.launch(arguments)
+	ds.restarting.Store(false)
+	ds.running.Unlock()
+	if err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp := new(dap.RestartResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.send(resp)
+	ds.sendStepBackCapability()
+	ds.run(ds.program())
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_SetBreakpoints
 func (ds *session) onSetBreakpointsRequest(request *dap.SetBreakpointsRequest) {
-	log.Println("breakpoint args")
-	for _, arg := range request.Arguments.Breakpoints {
-		log.Printf("\t%#v\n", arg)
-	}
 	resp := new(dap.SetBreakpointsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	path := request.Arguments.Source.Path
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	if ref := request.Arguments.Source.SourceReference; path == "" && ref > 0 && ds.vma != nil {
+		path = ds.vma.SourcePath(ref)
+	}
+	var breakpoints []*pkg.Breakpoint
+	for _, each := range request.Arguments.Breakpoints {
+		ds.breakpointIdSeq++
+		bp, err := pkg.NewBreakpoint(path, each)
+		if err != nil {
+			resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Id: ds.breakpointIdSeq, Line: each.Line, Message: err.Error()})
+			continue
+		}
+		bp.Id = ds.breakpointIdSeq
+		breakpoints = append(breakpoints, bp)
+		resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Id: bp.Id, Verified: true, Line: bp.Line, Source: &request.Arguments.Source})
+	}
+	if ds.breakpoints == nil {
+		ds.breakpoints = map[string][]*pkg.Breakpoint{}
+	}
+	ds.breakpoints[path] = breakpoints
+	for _, each := range ds.programs() {
+		each.SetBreakpoints(path, breakpoints)
+	}
 	ds.send(resp)
 }
 
+// sendConsoleOutput shows text in the debug console of the client, e.g. the message of a logpoint.
+func (ds *session) sendConsoleOutput(text string) {
+	e := &dap.OutputEvent{Event: *newEvent("output")}
+	e.Body.Category = "console"
+	e.Body.Output = text
+	ds.send(e)
+}
+
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_SetFunctionBreakpoints
 func (ds *session) onSetFunctionBreakpointsRequest(request *dap.SetFunctionBreakpointsRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "SetFunctionBreakpointsRequest is not yet supported"))
+	resp := new(dap.SetFunctionBreakpointsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	var breakpoints []*pkg.Breakpoint
+	for _, each := range request.Arguments.Breakpoints {
+		ds.breakpointIdSeq++
+		bp, err := pkg.NewFunctionBreakpoint(each)
+		if err != nil {
+			resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Id: ds.breakpointIdSeq, Message: err.Error()})
+			continue
+		}
+		bp.Id = ds.breakpointIdSeq
+		breakpoints = append(breakpoints, bp)
+		// functions can only be looked up once the program is launched
+		if ds.vma != nil && !ds.vma.HasFunction(bp) {
+			resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Id: bp.Id, Message: "no function " + bp.Function})
+			continue
+		}
+		resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Id: bp.Id, Verified: true})
+	}
+	ds.functionBreakpoints = breakpoints
+	for _, each := range ds.programs() {
+		each.SetFunctionBreakpoints(breakpoints)
+	}
+	ds.send(resp)
 }
 
+// filters of exception breakpoints
+const (
+	exceptionFilterAll      = "all"
+	exceptionFilterUncaught = "uncaught"
+)
+
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_SetExceptionBreakpoints
 func (ds *session) onSetExceptionBreakpointsRequest(request *dap.SetExceptionBreakpointsRequest) {
+	resp := new(dap.SetExceptionBreakpointsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	mode := pkg.BreakOnNoPanics
+	for _, each := range request.Arguments.Filters {
+		switch each {
+		case exceptionFilterAll:
+			mode = pkg.BreakOnAllPanics
+		case exceptionFilterUncaught:
+			if mode == pkg.BreakOnNoPanics {
+				mode = pkg.BreakOnUncaughtPanics
+			}
+		default:
+			resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Verified: false, Message: "unknown filter " + each})
+			continue
+		}
+		resp.Body.Breakpoints = append(resp.Body.Breakpoints, dap.Breakpoint{Verified: true})
+	}
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	ds.exceptionBreak = mode
+	for _, each := range ds.programs() {
+		each.SetExceptionBreakMode(mode)
+	}
+	ds.send(resp)
 }
 
-func (ds *session) onConfigurationDoneRequest(request *dap.ConfigurationDoneRequest) {}
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_ConfigurationDone
+func (ds *session) onConfigurationDoneRequest(request *dap.ConfigurationDoneRequest) {
+	resp := new(dap.ConfigurationDoneResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	if ds.host != nil {
+		if err := ds.attach(); err != nil {
+			ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+			return
+		}
+	}
+	ds.send(resp)
+	ds.start(func() { ds.configured = true })
+}
 
 func (ds *session) onContinueRequest(request *dap.ContinueRequest) {
+	vma, _ := ds.programOf(request.Arguments.ThreadId)
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	resp := new(dap.ContinueResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.AllThreadsContinued = ds.host == nil
+	ds.send(resp)
+	ds.doContinue(vma)
 }
 
 func (ds *session) onNextRequest(request *dap.NextRequest) {
 	resp := new(dap.NextResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
-	if ds.vma == nil {
+	vma, threadId := ds.programOf(request.Arguments.ThreadId)
+	if vma == nil {
 		resp.Success = false
 		ds.send(resp)
 		return
 	}
-	ds.vma.Next()
+	// an instruction is a step of the VM
+	reason, err := "step", error(nil)
+	if request.Arguments.Granularity == "instruction" {
+		err = vma.StepThread(threadId)
+	} else {
+		reason, err = vma.StepOver(threadId)
+	}
 	ds.send(resp)
+	ds.stepped(vma, reason, err)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_StepIn
 func (ds *session) onStepInRequest(request *dap.StepInRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "StepInRequest is not yet supported"))
+	resp := new(dap.StepInResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	vma, threadId := ds.programOf(request.Arguments.ThreadId)
+	if vma == nil {
+		resp.Success = false
+		ds.send(resp)
+		return
+	}
+	var err error
+	if request.Arguments.Granularity == "instruction" {
+		err = vma.StepThread(threadId)
+	} else {
+		err = vma.StepIn(threadId, request.Arguments.TargetId)
+	}
+	ds.send(resp)
+	ds.stepped(vma, "step", err)
+}
+
+// stepped notifies the client that a program has stopped after stepping, or has ended.
+func (ds *session) stepped(vma *pkg.DAPAccess, reason string, err error) {
+	if err == nil {
+		ds.sendStopped(vma, reason)
+		return
+	}
+	if _, ok := err.(*pkg.PanicStop); ok {
+		ds.sendStopped(vma, "exception")
+		return
+	}
+	// the program has ended or failed
+	ds.terminate(vma, err)
 }
 
 func (ds *session) onStepOutRequest(request *dap.StepOutRequest) {
@@ -263,34 +753,96 @@ func (ds *session) onStepOutRequest(request *dap.StepOutRequest) {
 }
 
 func (ds *session) onStepBackRequest(request *dap.StepBackRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "StepBackRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	if err := vma.StepBack(); err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp := new(dap.StepBackResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.send(resp)
+	ds.sendStopped(vma, "step")
 }
 
 func (ds *session) onReverseContinueRequest(request *dap.ReverseContinueRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "ReverseContinueRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	if !vma.CanStepBack() {
+		ds.send(newErrorResponse(request.Seq, request.Command, "steps are not recorded, launch with record"))
+		return
+	}
+	resp := new(dap.ReverseContinueResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.send(resp)
+	ds.doReverseContinue(vma)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_RestartFrame
 func (ds *session) onRestartFrameRequest(request *dap.RestartFrameRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "RestartFrameRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	if err := vma.RestartFrame(request.Arguments.FrameId); err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp := new(dap.RestartFrameResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.send(resp)
+	ds.sendStopped(vma, "restart")
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Goto
 func (ds *session) onGotoRequest(request *dap.GotoRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "GotoRequest is not yet supported"))
+	vma, threadId := ds.programOf(request.Arguments.ThreadId)
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	if threadId != vma.CurrentThreadId() {
+		ds.send(newErrorResponse(request.Seq, request.Command, "goto is only possible in the current thread"))
+		return
+	}
+	if err := vma.Goto(request.Arguments.TargetId); err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp := new(dap.GotoResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	ds.send(resp)
+	ds.sendStopped(vma, "goto")
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Pause
 func (ds *session) onPauseRequest(request *dap.PauseRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "PauseRequest is not yet supported"))
+	resp := new(dap.PauseResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	// the running continue loop stops at the next step boundary
+	ds.pauseRequested.Store(true)
+	ds.send(resp)
 }
 
 func (ds *session) onStackTraceRequest(request *dap.StackTraceRequest) {
 	resp := new(dap.StackTraceResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
-	if ds.vma == nil {
+	vma, threadId := ds.programOf(request.Arguments.ThreadId)
+	if vma == nil {
 		resp.Success = false
 		ds.send(resp)
 		return
 	}
-	resp.Body.StackFrames = ds.vma.StackFrames(request.Arguments)
+	args := request.Arguments
+	args.ThreadId = threadId
+	resp.Body.StackFrames = vma.StackFrames(args)
 	ds.send(resp)
 }
 
@@ -298,13 +850,14 @@ func (ds *session) onStackTraceRequest(request *dap.StackTraceRequest) {
 func (ds *session) onScopesRequest(request *dap.ScopesRequest) {
 	resp := new(dap.ScopesResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
-	if ds.vma == nil {
+	vma := ds.program()
+	if vma == nil {
 		resp.Success = false
 		ds.send(resp)
 		return
 	}
 	// https://microsoft.github.io/debug-adapter-protocol//specification.html#Types_Scope
-	resp.Body.Scopes = ds.vma.Scopes(request.Arguments)
+	resp.Body.Scopes = vma.Scopes(request.Arguments)
 	ds.send(resp)
 }
 
@@ -312,12 +865,13 @@ func (ds *session) onScopesRequest(request *dap.ScopesRequest) {
 func (ds *session) onVariablesRequest(request *dap.VariablesRequest) {
 	resp := new(dap.VariablesResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
-	if ds.vma == nil {
+	vma := ds.program()
+	if vma == nil {
 		resp.Success = false
 		ds.send(resp)
 		return
 	}
-	resp.Body.Variables = ds.vma.Variables(request.Arguments)
+	resp.Body.Variables = vma.Variables(request.Arguments)
 	ds.send(resp)
 }
 
@@ -332,16 +886,27 @@ func (ds *session) onSetExpressionRequest(request *dap.SetExpressionRequest) {
 }
 
 // https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Source
+// The client requests the content of sources with a source reference, such as of programs parsed from source.
 func (ds *session) onSourceRequest(request *dap.SourceRequest) {
 	resp := new(dap.SourceResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
-	if ds.vma == nil {
+	vma := ds.program()
+	if vma == nil {
 		resp.Success = false
 		ds.send(resp)
 		return
 	}
-	resp.Body.Content = fmt.Sprintf("%#v", request.Arguments.Source) // TODO SourceRequest should not be sent
-	resp.Success = true
+	ref, path := request.Arguments.SourceReference, ""
+	if source := request.Arguments.Source; source != nil {
+		ref, path = cmp.Or(source.SourceReference, ref), source.Path
+	}
+	content, err := vma.SourceContent(ref, path)
+	if err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp.Body.Content = content
+	resp.Body.MimeType = "text/x-go"
 	ds.send(resp)
 }
 
@@ -349,72 +914,247 @@ func (ds *session) onSourceRequest(request *dap.SourceRequest) {
 func (ds *session) onThreadsRequest(request *dap.ThreadsRequest) {
 	resp := new(dap.ThreadsResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
+	if ds.host != nil {
+		resp.Body.Threads = ds.attachedThreads()
+		if resp.Body.Threads == nil {
+			resp.Body.Threads = []dap.Thread{}
+		}
+		ds.send(resp)
+		return
+	}
 	// check launched
-	if ds.vma == nil {
+	vma := ds.program()
+	if vma == nil {
 		resp.Success = false
 		ds.send(resp)
 		return
 	}
-	resp.Body.Threads = ds.vma.Threads()
+	resp.Body.Threads = vma.Threads()
 	ds.send(resp)
 }
 
 // https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_TerminateThreads
 func (ds *session) onTerminateThreadsRequest(request *dap.TerminateThreadsRequest) {
 	// brutal
-	ds.vma = nil
+	ds.selectProgram(nil)
 	resp := new(dap.TerminateThreadsResponse)
 	resp.Response = *newResponse(request.Seq, request.Command)
 	resp.Success = true
 	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Evaluate
+// Expressions of the repl, watch and hover contexts are evaluated in the selected stack frame.
 func (ds *session) onEvaluateRequest(request *dap.EvaluateRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "EvaluateRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	value, typeName, err := vma.Evaluate(request.Arguments.Expression, request.Arguments.FrameId)
+	if err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp := new(dap.EvaluateResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Result = value
+	resp.Body.Type = typeName
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_StepInTargets
 func (ds *session) onStepInTargetsRequest(request *dap.StepInTargetsRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "StepInTargetRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	resp := new(dap.StepInTargetsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Targets = vma.StepInTargets(request.Arguments.FrameId)
+	if resp.Body.Targets == nil {
+		resp.Body.Targets = []dap.StepInTarget{}
+	}
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_GotoTargets
 func (ds *session) onGotoTargetsRequest(request *dap.GotoTargetsRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "GotoTargetRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	resp := new(dap.GotoTargetsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Targets = vma.GotoTargets(request.Arguments.Source.Path, request.Arguments.Line)
+	if resp.Body.Targets == nil {
+		resp.Body.Targets = []dap.GotoTarget{}
+	}
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Completions
 func (ds *session) onCompletionsRequest(request *dap.CompletionsRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "CompletionRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program to complete in"))
+		return
+	}
+	resp := new(dap.CompletionsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Targets = vma.Completions(request.Arguments.Text, request.Arguments.Column, request.Arguments.FrameId)
+	if resp.Body.Targets == nil {
+		resp.Body.Targets = []dap.CompletionItem{}
+	}
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_ExceptionInfo
 func (ds *session) onExceptionInfoRequest(request *dap.ExceptionInfoRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "ExceptionRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil || vma.ExceptionInfo() == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "not stopped at a panic"))
+		return
+	}
+	p := vma.ExceptionInfo()
+	resp := new(dap.ExceptionInfoResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.ExceptionId = "panic"
+	resp.Body.Description = fmt.Sprint(p.Value)
+	resp.Body.BreakMode = "always"
+	if p.Uncaught {
+		resp.Body.BreakMode = "unhandled"
+	}
+	resp.Body.Details = &dap.ExceptionDetails{
+		Message:    fmt.Sprint(p.Value),
+		TypeName:   p.TypeName(),
+		StackTrace: p.Stack,
+	}
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_LoadedSources
 func (ds *session) onLoadedSourcesRequest(request *dap.LoadedSourcesRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "LoadedRequest is not yet supported"))
+	resp := new(dap.LoadedSourcesResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Sources = []dap.Source{}
+	vma := ds.program()
+	if vma != nil {
+		resp.Body.Sources = vma.LoadedSources()
+	}
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_DataBreakpointInfo
 func (ds *session) onDataBreakpointInfoRequest(request *dap.DataBreakpointInfoRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "DataBreakpointInfoRequest is not yet supported"))
+	resp := new(dap.DataBreakpointInfoResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	vma := ds.program()
+	if vma == nil {
+		resp.Body.Description = "no program launched"
+		ds.send(resp)
+		return
+	}
+	dataId, err := vma.DataBreakpointInfo(request.Arguments.VariablesReference, request.Arguments.Name)
+	if err != nil {
+		// a null data id means that no data breakpoint can be set
+		resp.Body.Description = err.Error()
+		ds.send(resp)
+		return
+	}
+	resp.Body.DataId = dataId
+	resp.Body.Description = request.Arguments.Name
+	resp.Body.AccessTypes = []dap.DataBreakpointAccessType{"write"}
+	ds.send(resp)
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_SetDataBreakpoints
 func (ds *session) onSetDataBreakpointsRequest(request *dap.SetDataBreakpointsRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "SetDataBreakpointsRequest is not yet supported"))
+	resp := new(dap.SetDataBreakpointsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	var breakpoints []*pkg.Breakpoint
+	resp.Body.Breakpoints = make([]dap.Breakpoint, len(request.Arguments.Breakpoints))
+	var indexes []int // of the response breakpoints that are set
+	ds.mutex.Lock()
+	for i, each := range request.Arguments.Breakpoints {
+		ds.breakpointIdSeq++
+		resp.Body.Breakpoints[i].Id = ds.breakpointIdSeq
+		bp, err := pkg.NewDataBreakpoint(each)
+		if err != nil {
+			resp.Body.Breakpoints[i].Message = err.Error()
+			continue
+		}
+		bp.Id = ds.breakpointIdSeq
+		breakpoints = append(breakpoints, bp)
+		indexes = append(indexes, i)
+	}
+	ds.mutex.Unlock()
+	for i, ok := range vma.SetDataBreakpoints(breakpoints) {
+		result := &resp.Body.Breakpoints[indexes[i]]
+		result.Verified = ok
+		if !ok {
+			result.Message = "unknown data id " + breakpoints[i].DataId
+		}
+	}
+	ds.send(resp)
 }
 
 func (ds *session) onReadMemoryRequest(request *dap.ReadMemoryRequest) {
 	ds.send(newErrorResponse(request.Seq, request.Command, "ReadMemoryRequest is not yet supported"))
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_Disassemble
+// The instructions are the steps of the VM, see the instruction pointer reference of a stack frame.
 func (ds *session) onDisassembleRequest(request *dap.DisassembleRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "DisassembleRequest is not yet supported"))
+	vma := ds.program()
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	instructions, err := vma.Disassemble(request.Arguments)
+	if err != nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, err.Error()))
+		return
+	}
+	resp := new(dap.DisassembleResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Instructions = instructions
+	ds.send(resp)
 }
 
 func (ds *session) onCancelRequest(request *dap.CancelRequest) {
 	ds.send(newErrorResponse(request.Seq, request.Command, "CancelRequest is not yet supported"))
 }
 
+// https://microsoft.github.io/debug-adapter-protocol//specification.html#Requests_BreakpointLocations
 func (ds *session) onBreakpointLocationsRequest(request *dap.BreakpointLocationsRequest) {
-	ds.send(newErrorResponse(request.Seq, request.Command, "BreakpointLocationsRequest is not yet supported"))
+	vma, args := ds.program(), request.Arguments
+	if vma == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "no program launched"))
+		return
+	}
+	if args == nil {
+		ds.send(newErrorResponse(request.Seq, request.Command, "missing arguments"))
+		return
+	}
+	path := args.Source.Path
+	if ref := args.Source.SourceReference; path == "" && ref > 0 {
+		path = vma.SourcePath(ref)
+	}
+	resp := new(dap.BreakpointLocationsResponse)
+	resp.Response = *newResponse(request.Seq, request.Command)
+	resp.Body.Breakpoints = vma.BreakpointLocations(path, args.Line, args.EndLine)
+	if resp.Body.Breakpoints == nil {
+		resp.Body.Breakpoints = []dap.BreakpointLocation{}
+	}
+	ds.send(resp)
 }
 
 func (ds *session) dispatchRequest(request dap.Message) {
@@ -0,0 +1,1089 @@
+package dap
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emicklei/gi/pkg"
+	"github.com/google/go-dap"
+)
+
+// newTestSession returns a session with the program launched ; messages to the client are read from sendQueue.
+func newTestSession(t *testing.T, source string) *session {
+	t.Helper()
+	ds, _ := newTestSessionWithPath(t, source)
+	return ds
+}
+
+// newTestSessionWithPath returns a session with a launched program and the path of its source file.
+func newTestSessionWithPath(t *testing.T, source string, options ...pkg.VMOption) (*session, string) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	gopkg, err := pkg.ParseSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pkg.BuildPackage(gopkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := &session{
+		sendQueue:    make(chan dap.Message, 16),
+		stopStepping: make(chan struct{}),
+	}
+	ds.vma = pkg.NewDAPAccess(pkg.NewVM(p, options...))
+	ds.vma.Log = ds.sendConsoleOutput
+	ds.vma.Launch("main", nil)
+	return ds, gopkg.GoFiles[0]
+}
+
+// receive returns the next message sent to the client.
+func receive(t *testing.T, ds *session) dap.Message {
+	t.Helper()
+	select {
+	case m := <-ds.sendQueue:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func TestPauseRunningProgram(t *testing.T) {
+	ds := newTestSession(t, `package main
+
+func main() {
+	i := 0
+	for {
+		i++
+	}
+}`)
+	go ds.onContinueRequest(&dap.ContinueRequest{Request: dap.Request{Command: "continue"}})
+	if _, ok := receive(t, ds).(*dap.ContinueResponse); !ok {
+		t.Fatal("expected continue response")
+	}
+	time.Sleep(10 * time.Millisecond)
+	ds.onPauseRequest(&dap.PauseRequest{Request: dap.Request{Command: "pause"}})
+	if _, ok := receive(t, ds).(*dap.PauseResponse); !ok {
+		t.Fatal("expected pause response")
+	}
+	stopped, ok := receive(t, ds).(*dap.StoppedEvent)
+	if !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := stopped.Body.Reason, "pause"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := stopped.Body.ThreadId, 1; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	// the program can be inspected where it was paused
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	if len(frames) == 0 {
+		t.Error("expected frames")
+	}
+}
+
+func TestContinueUntilTerminated(t *testing.T) {
+	ds := newTestSession(t, `package main
+
+func main() {
+	i := 0
+	i++
+}`)
+	go ds.onContinueRequest(&dap.ContinueRequest{Request: dap.Request{Command: "continue"}})
+	if _, ok := receive(t, ds).(*dap.ContinueResponse); !ok {
+		t.Fatal("expected continue response")
+	}
+	exited, ok := receive(t, ds).(*dap.ExitedEvent)
+	if !ok {
+		t.Fatal("expected exited event")
+	}
+	if got, want := exited.Body.ExitCode, 0; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if _, ok := receive(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+const recoveredPanicSource = `package main
+
+func main() {
+	defer func() {
+		recover()
+	}()
+	panic("boom")
+}`
+
+const uncaughtPanicSource = `package main
+
+func fail(msg string) {
+	panic(msg)
+}
+func main() {
+	fail("boom")
+}`
+
+func setExceptionFilter(t *testing.T, ds *session, filter string) {
+	t.Helper()
+	ds.onSetExceptionBreakpointsRequest(&dap.SetExceptionBreakpointsRequest{
+		Request:   dap.Request{Command: "setExceptionBreakpoints"},
+		Arguments: dap.SetExceptionBreakpointsArguments{Filters: []string{filter}}})
+	if resp := receive(t, ds).(*dap.SetExceptionBreakpointsResponse); !resp.Body.Breakpoints[0].Verified {
+		t.Fatal("expected verified filter")
+	}
+}
+
+// continueUntilStopped sends a continue request and returns the event that follows the response.
+// The exited event that precedes the terminated event is skipped.
+func continueUntilStopped(t *testing.T, ds *session) dap.Message {
+	t.Helper()
+	go ds.onContinueRequest(&dap.ContinueRequest{Request: dap.Request{Command: "continue"}})
+	if _, ok := receive(t, ds).(*dap.ContinueResponse); !ok {
+		t.Fatal("expected continue response")
+	}
+	m := receive(t, ds)
+	if _, ok := m.(*dap.ExitedEvent); ok {
+		return receive(t, ds)
+	}
+	return m
+}
+
+func exceptionInfo(t *testing.T, ds *session) *dap.ExceptionInfoResponse {
+	t.Helper()
+	ds.onExceptionInfoRequest(&dap.ExceptionInfoRequest{Request: dap.Request{Command: "exceptionInfo"}})
+	info, ok := receive(t, ds).(*dap.ExceptionInfoResponse)
+	if !ok {
+		t.Fatal("expected exception info")
+	}
+	return info
+}
+
+func TestExceptionBreakpointAllPanics(t *testing.T) {
+	ds := newTestSession(t, recoveredPanicSource)
+	setExceptionFilter(t, ds, "all")
+	stopped, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent)
+	if !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := stopped.Body.Reason, "exception"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	info := exceptionInfo(t, ds)
+	if got, want := info.Body.Description, "boom"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := info.Body.BreakMode, dap.ExceptionBreakMode("always"); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := info.Body.Details.TypeName, "string"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// the panic is recovered by the deferred function
+	if _, ok := continueUntilStopped(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+func TestExceptionBreakpointUncaughtPanics(t *testing.T) {
+	ds := newTestSession(t, recoveredPanicSource)
+	setExceptionFilter(t, ds, "uncaught")
+	if _, ok := continueUntilStopped(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event because the panic is recovered")
+	}
+
+	ds = newTestSession(t, uncaughtPanicSource)
+	setExceptionFilter(t, ds, "uncaught")
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	info := exceptionInfo(t, ds)
+	if got, want := info.Body.BreakMode, dap.ExceptionBreakMode("unhandled"); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// stopped at the panic with the stack intact
+	for _, want := range []string{"goroutine 1 [running]:\nmain.fail(...)", "main.main(...)"} {
+		if got := info.Body.Details.StackTrace; !strings.Contains(got, want) {
+			t.Errorf("got %q want to contain %q", got, want)
+		}
+	}
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	if got, want := frames[0].Name, "fail"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+	if _, ok := continueUntilStopped(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+const loopSource = `package main
+
+func main() {
+	sum := 0
+	for i := 0; i < 5; i++ {
+		sum += i
+	}
+}`
+
+func setBreakpoints(t *testing.T, ds *session, path string, breakpoints ...dap.SourceBreakpoint) *dap.SetBreakpointsResponse {
+	t.Helper()
+	ds.onSetBreakpointsRequest(&dap.SetBreakpointsRequest{
+		Request: dap.Request{Command: "setBreakpoints"},
+		Arguments: dap.SetBreakpointsArguments{
+			Source:      dap.Source{Path: path},
+			Breakpoints: breakpoints,
+		}})
+	resp, ok := receive(t, ds).(*dap.SetBreakpointsResponse)
+	if !ok {
+		t.Fatal("expected set breakpoints response")
+	}
+	return resp
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	resp := setBreakpoints(t, ds, path,
+		dap.SourceBreakpoint{Line: 6, Condition: "i == 3"},
+		dap.SourceBreakpoint{Line: 6, Condition: "i ="})
+	if !resp.Body.Breakpoints[0].Verified {
+		t.Error("expected verified breakpoint")
+	}
+	if resp.Body.Breakpoints[1].Verified || resp.Body.Breakpoints[1].Message == "" {
+		t.Error("expected unverified breakpoint with message")
+	}
+	stopped, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent)
+	if !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := stopped.Body.Reason, "breakpoint"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, ok := continueUntilStopped(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+func TestStackTraceAtBreakpoint(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, `package main
+
+type T struct{ n int }
+
+func (t T) M(i int) int {
+	return i + 1
+}
+
+func main() {
+	v := T{}
+	call := func() int { return v.M(1) }
+	print(call())
+}`)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	ds.onStackTraceRequest(&dap.StackTraceRequest{Request: dap.Request{Command: "stackTrace"},
+		Arguments: dap.StackTraceArguments{ThreadId: 1}})
+	resp, ok := receive(t, ds).(*dap.StackTraceResponse)
+	if !ok {
+		t.Fatal("expected stack trace response")
+	}
+	// innermost first ; a caller is at its call
+	type frame struct {
+		name string
+		line int
+	}
+	var got []frame
+	for _, each := range resp.Body.StackFrames {
+		got = append(got, frame{each.Name, each.Line})
+	}
+	want := []frame{{"main.T.M", 6}, {"main.main.func1", 11}, {"main.main", 12}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v want %v", got[i], want[i])
+		}
+	}
+}
+
+func TestLogpoint(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6, HitCondition: "% 2", LogMessage: "i is {i}"})
+	output, ok := continueUntilStopped(t, ds).(*dap.OutputEvent)
+	if !ok {
+		t.Fatal("expected output event")
+	}
+	if got, want := output.Body.Output, "i is 1\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// the program does not stop at logpoints
+	output, ok = receive(t, ds).(*dap.OutputEvent)
+	if !ok {
+		t.Fatal("expected output event")
+	}
+	if got, want := output.Body.Output, "i is 3\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, ok := receive(t, ds).(*dap.ExitedEvent); !ok {
+		t.Fatal("expected exited event")
+	}
+	if _, ok := receive(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+func TestFunctionBreakpoint(t *testing.T) {
+	ds := newTestSession(t, `package main
+
+func handle(n int) int {
+	return n * 2
+}
+func main() {
+	handle(1)
+	handle(2)
+}`)
+	ds.onSetFunctionBreakpointsRequest(&dap.SetFunctionBreakpointsRequest{
+		Request: dap.Request{Command: "setFunctionBreakpoints"},
+		Arguments: dap.SetFunctionBreakpointsArguments{Breakpoints: []dap.FunctionBreakpoint{
+			{Name: "main.handle", HitCondition: "2"},
+			{Name: "main.missing"},
+		}}})
+	resp, ok := receive(t, ds).(*dap.SetFunctionBreakpointsResponse)
+	if !ok {
+		t.Fatal("expected set function breakpoints response")
+	}
+	if !resp.Body.Breakpoints[0].Verified || resp.Body.Breakpoints[1].Verified {
+		t.Errorf("got %#v", resp.Body.Breakpoints)
+	}
+	stopped, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent)
+	if !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := stopped.Body.Reason, "function breakpoint"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// stopped at the second call
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	if got, want := frames[0].Name, "handle"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+	scopes := ds.vma.Scopes(dap.ScopesArguments{FrameId: frames[0].Id})
+	vars := ds.vma.Variables(dap.VariablesArguments{VariablesReference: scopes[len(scopes)-1].VariablesReference})
+	for _, each := range vars {
+		if each.Name == "n" && each.Value != "2" {
+			t.Errorf("got %q want %q", each.Value, "2")
+		}
+	}
+	if _, ok := continueUntilStopped(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+func TestDataBreakpoint(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	setBreakpoints(t, ds, path)
+	ds.onDataBreakpointInfoRequest(&dap.DataBreakpointInfoRequest{
+		Request:   dap.Request{Command: "dataBreakpointInfo"},
+		Arguments: dap.DataBreakpointInfoArguments{Name: "sum"}})
+	info, ok := receive(t, ds).(*dap.DataBreakpointInfoResponse)
+	if !ok || info.Body.DataId == nil {
+		t.Fatalf("expected data id, got %#v", info)
+	}
+	ds.onSetDataBreakpointsRequest(&dap.SetDataBreakpointsRequest{
+		Request: dap.Request{Command: "setDataBreakpoints"},
+		Arguments: dap.SetDataBreakpointsArguments{Breakpoints: []dap.DataBreakpoint{
+			{DataId: info.Body.DataId.(string), HitCondition: "2"},
+			{DataId: "unknown"},
+		}}})
+	resp, ok := receive(t, ds).(*dap.SetDataBreakpointsResponse)
+	if !ok {
+		t.Fatal("expected set data breakpoints response")
+	}
+	if !resp.Body.Breakpoints[0].Verified || resp.Body.Breakpoints[1].Verified {
+		t.Errorf("got %#v", resp.Body.Breakpoints)
+	}
+	stopped, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent)
+	if !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := stopped.Body.Reason, "data breakpoint"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// sum += 0 does not change the value
+	if got, want := stopped.Body.Text, "sum changed from 1 to 3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestReverseContinue(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource, pkg.WithRecording(0))
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6, Condition: "i == 3"})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6, Condition: "i == 1"})
+	go ds.onReverseContinueRequest(&dap.ReverseContinueRequest{Request: dap.Request{Command: "reverseContinue"}})
+	if _, ok := receive(t, ds).(*dap.ReverseContinueResponse); !ok {
+		t.Fatal("expected reverse continue response")
+	}
+	stopped, ok := receive(t, ds).(*dap.StoppedEvent)
+	if !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := stopped.Body.Reason, "breakpoint"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	ds.onStepBackRequest(&dap.StepBackRequest{Request: dap.Request{Command: "stepBack"}})
+	if _, ok := receive(t, ds).(*dap.StepBackResponse); !ok {
+		t.Fatal("expected step back response")
+	}
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "step" {
+		t.Fatal("expected stopped event after step")
+	}
+}
+
+func TestStepBackNotRecorded(t *testing.T) {
+	ds := newTestSession(t, loopSource)
+	ds.onStepBackRequest(&dap.StepBackRequest{Request: dap.Request{Command: "stepBack"}})
+	if resp, ok := receive(t, ds).(*dap.ErrorResponse); !ok || resp.Success {
+		t.Fatal("expected error response")
+	}
+}
+
+// variable returns the value of a variable in the innermost scope of the top frame that has it.
+func variable(t *testing.T, ds *session, name string) string {
+	t.Helper()
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: ds.vma.CurrentThreadId()})
+	for _, scope := range ds.vma.Scopes(dap.ScopesArguments{FrameId: frames[0].Id}) {
+		for _, each := range ds.vma.Variables(dap.VariablesArguments{VariablesReference: scope.VariablesReference}) {
+			if each.Name == name {
+				return each.Value
+			}
+		}
+	}
+	t.Fatalf("no variable %s", name)
+	return ""
+}
+
+func TestRestartFrame(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6, Condition: "i == 3"})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	ds.onRestartFrameRequest(&dap.RestartFrameRequest{
+		Request:   dap.Request{Command: "restartFrame"},
+		Arguments: dap.RestartFrameArguments{FrameId: frames[0].Id}})
+	if _, ok := receive(t, ds).(*dap.RestartFrameResponse); !ok {
+		t.Fatal("expected restart frame response")
+	}
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "restart" {
+		t.Fatal("expected stopped event for restart")
+	}
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := variable(t, ds, "sum"), "3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestRestartRebuildsFromDisk(t *testing.T) {
+	log.SetOutput(io.Discard)
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module restart\n\ngo 1.24\n")
+	write("main.go", "package main\n\nfunc main() {\n\tx := 1\n\tprint(x)\n}\n")
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	ds := &session{
+		sendQueue:    make(chan dap.Message, 16),
+		stopStepping: make(chan struct{}),
+	}
+	setBreakpoints(t, ds, filepath.Join(dir, "main.go"), dap.SourceBreakpoint{Line: 5})
+	ds.onLaunchRequest(&dap.LaunchRequest{Request: dap.Request{Command: "launch"}, Arguments: []byte(`{"stepPolicy":"continue","stopOnEntry":true}`)})
+	if resp, ok := receive(t, ds).(*dap.LaunchResponse); !ok || !resp.Success {
+		t.Fatalf("expected launch response, got %#v", resp)
+	}
+	ds.onConfigurationDoneRequest(&dap.ConfigurationDoneRequest{Request: dap.Request{Command: "configurationDone"}})
+	if _, ok := receive(t, ds).(*dap.ConfigurationDoneResponse); !ok {
+		t.Fatal("expected configuration done response")
+	}
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "entry" {
+		t.Fatal("expected stopped event on entry")
+	}
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := variable(t, ds, "x"), "1"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	write("main.go", "package main\n\nfunc main() {\n\tx := 2\n\tprint(x)\n}\n")
+	ds.onRestartRequest(&dap.RestartRequest{Request: dap.Request{Command: "restart"}})
+	if _, ok := receive(t, ds).(*dap.RestartResponse); !ok {
+		t.Fatal("expected restart response")
+	}
+	receive(t, ds) // stopped
+	if got, want := ds.vma.StepPolicy, pkg.ContinueOthers; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event at breakpoint kept by restart")
+	}
+	if got, want := variable(t, ds, "x"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestRestartWhileRunning(t *testing.T) {
+	ds := launchProgram(t, `package main
+
+func main() {
+	i := 0
+	for {
+		i++
+	}
+}`, `{"stopOnEntry":true}`)
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "entry" {
+		t.Fatal("expected stopped event on entry")
+	}
+	go ds.onContinueRequest(&dap.ContinueRequest{Request: dap.Request{Command: "continue"}})
+	if _, ok := receive(t, ds).(*dap.ContinueResponse); !ok {
+		t.Fatal("expected continue response")
+	}
+	ds.onRestartRequest(&dap.RestartRequest{Request: dap.Request{Command: "restart"}})
+	if _, ok := receive(t, ds).(*dap.RestartResponse); !ok {
+		t.Fatal("expected restart response")
+	}
+	// no stopped event of the program before restart
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "entry" {
+		t.Fatalf("expected stopped event on entry, got %#v", stopped)
+	}
+}
+
+func TestSetBreakpointsWhileRunning(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, `package main
+
+func main() {
+	i := 0
+	for {
+		i++
+	}
+}`)
+	go ds.onContinueRequest(&dap.ContinueRequest{Request: dap.Request{Command: "continue"}})
+	if _, ok := receive(t, ds).(*dap.ContinueResponse); !ok {
+		t.Fatal("expected continue response")
+	}
+	// handled concurrently with the running program
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6})
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "breakpoint" {
+		t.Fatalf("expected stopped event at breakpoint, got %#v", stopped)
+	}
+}
+
+func TestGoto(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6, Condition: "i == 4"})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	ds.onGotoTargetsRequest(&dap.GotoTargetsRequest{
+		Request:   dap.Request{Command: "gotoTargets"},
+		Arguments: dap.GotoTargetsArguments{Source: dap.Source{Path: path}, Line: 5}})
+	targets, ok := receive(t, ds).(*dap.GotoTargetsResponse)
+	if !ok || len(targets.Body.Targets) == 0 {
+		t.Fatal("expected goto targets")
+	}
+	ds.onGotoRequest(&dap.GotoRequest{
+		Request:   dap.Request{Command: "goto"},
+		Arguments: dap.GotoArguments{ThreadId: ds.vma.CurrentThreadId(), TargetId: targets.Body.Targets[0].Id}})
+	if _, ok := receive(t, ds).(*dap.GotoResponse); !ok {
+		t.Fatal("expected goto response")
+	}
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "goto" {
+		t.Fatal("expected stopped event for goto")
+	}
+	// the loop starts again with the sum so far
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6, Condition: "i == 1"})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := variable(t, ds, "sum"), "6"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+const launchSource = `package main
+
+import "os"
+
+func greet(name string, times int) {
+	s := ""
+	for range times {
+		s += name
+	}
+	print(s)
+}
+
+func main() {
+	arg := os.Args[1]
+	env := os.Getenv("GI_LAUNCH_TEST")
+	print(arg, env)
+}
+`
+
+// launchProgram writes the source as main package in a temporary directory and launches it with the configuration.
+// The program is started by the configuration done request.
+func launchProgram(t *testing.T, source string, config string, breakpoints ...dap.SourceBreakpoint) *session {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module launch\n\ngo 1.24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ds := &session{
+		sendQueue:    make(chan dap.Message, 16),
+		stopStepping: make(chan struct{}),
+	}
+	if len(breakpoints) > 0 {
+		setBreakpoints(t, ds, filepath.Join(dir, "main.go"), breakpoints...)
+	}
+	arguments := map[string]any{}
+	if err := json.Unmarshal([]byte(config), &arguments); err != nil {
+		t.Fatal(err)
+	}
+	arguments["program"] = filepath.Join(dir, "main.go")
+	data, _ := json.Marshal(arguments)
+	ds.onLaunchRequest(&dap.LaunchRequest{Request: dap.Request{Command: "launch"}, Arguments: data})
+	if resp, ok := receive(t, ds).(*dap.LaunchResponse); !ok || !resp.Success {
+		t.Fatalf("expected launch response, got %#v", resp)
+	}
+	ds.onConfigurationDoneRequest(&dap.ConfigurationDoneRequest{Request: dap.Request{Command: "configurationDone"}})
+	if _, ok := receive(t, ds).(*dap.ConfigurationDoneResponse); !ok {
+		t.Fatal("expected configuration done response")
+	}
+	return ds
+}
+
+func TestLaunchWithArgsAndEnv(t *testing.T) {
+	ds := launchProgram(t, launchSource, `{"args":["hello"],"env":{"GI_LAUNCH_TEST":"world"}}`,
+		dap.SourceBreakpoint{Line: 16})
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "breakpoint" {
+		t.Fatal("expected stopped event at breakpoint")
+	}
+	if got, want := variable(t, ds, "arg"), "hello"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := variable(t, ds, "env"), "world"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, ok := os.LookupEnv("GI_LAUNCH_TEST"); ok {
+		t.Error("expected no change of the server environment")
+	}
+}
+
+func TestLaunchStopOnEntry(t *testing.T) {
+	ds := launchProgram(t, launchSource, `{"stopOnEntry":true,"args":["x"]}`)
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "entry" {
+		t.Fatal("expected stopped event on entry")
+	}
+}
+
+func TestLaunchNoDebug(t *testing.T) {
+	ds := launchProgram(t, launchSource, `{"noDebug":true,"stopOnEntry":true,"args":["x"]}`,
+		dap.SourceBreakpoint{Line: 16})
+	output, code := receiveUntilTerminated(t, ds)
+	if got, want := output["stdout"], "x"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := code, 0; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestLaunchFunction(t *testing.T) {
+	ds := launchProgram(t, launchSource, `{"function":"greet","functionArgs":["go",3]}`,
+		dap.SourceBreakpoint{Line: 10})
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "breakpoint" {
+		t.Fatal("expected stopped event at breakpoint")
+	}
+	if got, want := variable(t, ds, "s"), "gogogo"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestLaunchFunctionInvalidArgs(t *testing.T) {
+	log.SetOutput(io.Discard)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module launch\n\ngo 1.24\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(launchSource), 0644)
+	ds := &session{
+		sendQueue:    make(chan dap.Message, 16),
+		stopStepping: make(chan struct{}),
+	}
+	ds.onLaunchRequest(&dap.LaunchRequest{Request: dap.Request{Command: "launch"},
+		Arguments: []byte(`{"program":"` + dir + `","function":"greet","functionArgs":["go"]}`)})
+	resp, ok := receive(t, ds).(*dap.LaunchResponse)
+	if !ok || resp.Success {
+		t.Fatal("expected failed launch response")
+	}
+	if !strings.Contains(resp.Message, "2 parameter(s) but got 1") {
+		t.Errorf("unexpected message %q", resp.Message)
+	}
+}
+
+func TestLaunchRecordSupportsStepBack(t *testing.T) {
+	log.SetOutput(io.Discard)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module launch\n\ngo 1.24\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(launchSource), 0644)
+	ds := &session{
+		sendQueue:    make(chan dap.Message, 16),
+		stopStepping: make(chan struct{}),
+	}
+	ds.onLaunchRequest(&dap.LaunchRequest{Request: dap.Request{Command: "launch"},
+		Arguments: []byte(`{"program":"` + dir + `","record":true,"args":["x"]}`)})
+	if resp, ok := receive(t, ds).(*dap.LaunchResponse); !ok || !resp.Success {
+		t.Fatalf("expected launch response, got %#v", resp)
+	}
+	e, ok := receive(t, ds).(*dap.CapabilitiesEvent)
+	if !ok || !e.Body.Capabilities.SupportsStepBack {
+		t.Fatalf("expected capabilities event, got %#v", e)
+	}
+}
+
+// receiveUntilTerminated returns the output events by category and the exit code of a program that runs to the end.
+func receiveUntilTerminated(t *testing.T, ds *session) (output map[string]string, exitCode int) {
+	t.Helper()
+	output = map[string]string{}
+	exitCode = -1
+	for {
+		switch m := receive(t, ds).(type) {
+		case *dap.OutputEvent:
+			output[m.Body.Category] += m.Body.Output
+		case *dap.ExitedEvent:
+			exitCode = m.Body.ExitCode
+		case *dap.TerminatedEvent:
+			return
+		case *dap.StoppedEvent:
+			t.Fatalf("unexpected stopped event %q", m.Body.Reason)
+		}
+	}
+}
+
+func TestProgramOutputEvents(t *testing.T) {
+	ds := launchProgram(t, `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("hello")
+	fmt.Fprintln(os.Stderr, "oops")
+	os.Exit(3)
+	fmt.Println("not reached")
+}
+`, `{}`)
+	output, code := receiveUntilTerminated(t, ds)
+	if got, want := output["stdout"], "hello\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := output["stderr"], "oops\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := code, 3; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestProgramPanicExitCode(t *testing.T) {
+	ds := launchProgram(t, `package main
+
+func main() {
+	panic("boom")
+}
+`, `{}`)
+	if _, code := receiveUntilTerminated(t, ds); code != 2 {
+		t.Errorf("got %d want 2", code)
+	}
+}
+
+func TestSessionsAreIsolated(t *testing.T) {
+	source := `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Print(os.Args[1], os.Getenv("GI_SESSION"))
+	os.Exit(len(os.Args))
+}
+`
+	one := launchProgram(t, source, `{"args":["a"],"env":{"GI_SESSION":"1"}}`)
+	two := launchProgram(t, source, `{"args":["b","c"],"env":{"GI_SESSION":"2"}}`)
+	output, code := receiveUntilTerminated(t, two)
+	if got, want := output["stdout"], "b2"; got != want || code != 3 {
+		t.Errorf("got %q %d want %q 3", got, code, want)
+	}
+	output, code = receiveUntilTerminated(t, one)
+	if got, want := output["stdout"], "a1"; got != want || code != 2 {
+		t.Errorf("got %q %d want %q 2", got, code, want)
+	}
+}
+
+func TestLoadedSourcesAndSource(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	ds.onLoadedSourcesRequest(&dap.LoadedSourcesRequest{Request: dap.Request{Command: "loadedSources"}})
+	loaded, ok := receive(t, ds).(*dap.LoadedSourcesResponse)
+	if !ok || len(loaded.Body.Sources) != 1 {
+		t.Fatal("expected one loaded source")
+	}
+	source := loaded.Body.Sources[0]
+	if source.Path != path || source.SourceReference == 0 {
+		t.Fatalf("unexpected source %#v", source)
+	}
+	ds.onSourceRequest(&dap.SourceRequest{Request: dap.Request{Command: "source"},
+		Arguments: dap.SourceArguments{Source: &source, SourceReference: source.SourceReference}})
+	content, ok := receive(t, ds).(*dap.SourceResponse)
+	if !ok {
+		t.Fatal("expected source response")
+	}
+	if got, want := content.Body.Content, loopSource; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// a breakpoint can be set by reference only
+	ds.onSetBreakpointsRequest(&dap.SetBreakpointsRequest{Request: dap.Request{Command: "setBreakpoints"},
+		Arguments: dap.SetBreakpointsArguments{Source: dap.Source{SourceReference: source.SourceReference},
+			Breakpoints: []dap.SourceBreakpoint{{Line: 6, Condition: "i == 2"}}}})
+	receive(t, ds)
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	if got, want := variable(t, ds, "i"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	ds.onCompletionsRequest(&dap.CompletionsRequest{Request: dap.Request{Command: "completions"},
+		Arguments: dap.CompletionsArguments{Text: "su", Column: 3}})
+	resp, ok := receive(t, ds).(*dap.CompletionsResponse)
+	if !ok {
+		t.Fatal("expected completions response")
+	}
+	var labels []string
+	for _, each := range resp.Body.Targets {
+		labels = append(labels, each.Label)
+	}
+	if got, want := strings.Join(labels, ","), "sum"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+// next sends a next request with a granularity and returns the instruction pointer of the top frame when stopped.
+func next(t *testing.T, ds *session, granularity dap.SteppingGranularity) string {
+	t.Helper()
+	ds.onNextRequest(&dap.NextRequest{Request: dap.Request{Command: "next"},
+		Arguments: dap.NextArguments{ThreadId: 1, Granularity: granularity}})
+	if _, ok := receive(t, ds).(*dap.NextResponse); !ok {
+		t.Fatal("expected next response")
+	}
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "step" {
+		t.Fatal("expected stopped event after step")
+	}
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	return frames[0].InstructionPointerReference
+}
+
+func disassemble(t *testing.T, ds *session, ip string) dap.DisassembledInstruction {
+	t.Helper()
+	ds.onDisassembleRequest(&dap.DisassembleRequest{Request: dap.Request{Command: "disassemble"},
+		Arguments: dap.DisassembleArguments{MemoryReference: ip, InstructionCount: 1}})
+	resp, ok := receive(t, ds).(*dap.DisassembleResponse)
+	if !ok || len(resp.Body.Instructions) != 1 {
+		t.Fatal("expected one instruction")
+	}
+	return resp.Body.Instructions[0]
+}
+
+func TestNextInstructionAndDisassemble(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, loopSource)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 6})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	before := frames[0].InstructionPointerReference
+	after := next(t, ds, "instruction")
+	if before == after {
+		t.Fatal("expected another instruction")
+	}
+	if got, want := disassemble(t, ds, after).Line, 6; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	// the loop statement is next
+	if got, want := disassemble(t, ds, next(t, ds, "line")).Line, 5; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+const callsSource = `package main
+
+func double(x int) int {
+	return x * 2
+}
+func main() {
+	y := double(double(1))
+	print(y)
+}`
+
+func TestStepInTargetsAndStepIn(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, callsSource)
+	ds.onBreakpointLocationsRequest(&dap.BreakpointLocationsRequest{Request: dap.Request{Command: "breakpointLocations"},
+		Arguments: &dap.BreakpointLocationsArguments{Source: dap.Source{Path: path}, Line: 5, EndLine: 7}})
+	locations, ok := receive(t, ds).(*dap.BreakpointLocationsResponse)
+	if !ok || len(locations.Body.Breakpoints) != 1 || locations.Body.Breakpoints[0].Line != 7 {
+		t.Fatal("expected a breakpoint location on line 7")
+	}
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 7})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	ds.onStepInTargetsRequest(&dap.StepInTargetsRequest{Request: dap.Request{Command: "stepInTargets"}})
+	targets, ok := receive(t, ds).(*dap.StepInTargetsResponse)
+	if !ok || len(targets.Body.Targets) != 2 {
+		t.Fatal("expected two step in targets")
+	}
+	// the outer call
+	ds.onStepInRequest(&dap.StepInRequest{Request: dap.Request{Command: "stepIn"},
+		Arguments: dap.StepInArguments{ThreadId: 1, TargetId: targets.Body.Targets[1].Id}})
+	if _, ok := receive(t, ds).(*dap.StepInResponse); !ok {
+		t.Fatal("expected step in response")
+	}
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "step" {
+		t.Fatal("expected stopped event after step")
+	}
+	if got, want := variable(t, ds, "x"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestStepPastRuntimeError(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, `package main
+
+func main() {
+	list := []int{}
+	print(list[1])
+}`)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 5})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	ds.onNextRequest(&dap.NextRequest{Request: dap.Request{Command: "next"}, Arguments: dap.NextArguments{ThreadId: 1}})
+	if _, ok := receive(t, ds).(*dap.NextResponse); !ok {
+		t.Fatal("expected next response")
+	}
+	exited, ok := receive(t, ds).(*dap.ExitedEvent)
+	if !ok {
+		t.Fatal("expected exited event")
+	}
+	if got, want := exited.Body.ExitCode, 2; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if _, ok := receive(t, ds).(*dap.TerminatedEvent); !ok {
+		t.Fatal("expected terminated event")
+	}
+}
+
+func TestEvaluateInFrames(t *testing.T) {
+	ds, path := newTestSessionWithPath(t, `package main
+
+func double(x int) int {
+	return x * 2
+}
+func main() {
+	y := 20
+	print(double(y + 1))
+}`)
+	setBreakpoints(t, ds, path, dap.SourceBreakpoint{Line: 4})
+	if _, ok := continueUntilStopped(t, ds).(*dap.StoppedEvent); !ok {
+		t.Fatal("expected stopped event")
+	}
+	frames := ds.vma.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	for _, each := range []struct {
+		context    string
+		expression string
+		frameId    int
+		result     string
+	}{
+		{"repl", "x * 2", frames[0].Id, "42"},
+		{"watch", "y - 1", frames[1].Id, "19"},
+		{"hover", "x", 0, "21"},
+	} {
+		ds.onEvaluateRequest(&dap.EvaluateRequest{Request: dap.Request{Command: "evaluate"},
+			Arguments: dap.EvaluateArguments{Expression: each.expression, FrameId: each.frameId, Context: each.context}})
+		resp, ok := receive(t, ds).(*dap.EvaluateResponse)
+		if !ok {
+			t.Fatalf("expected evaluate response for %s", each.expression)
+		}
+		if got, want := resp.Body.Result, each.result; got != want {
+			t.Errorf("%s: got %q want %q", each.expression, got, want)
+		}
+	}
+	ds.onEvaluateRequest(&dap.EvaluateRequest{Request: dap.Request{Command: "evaluate"},
+		Arguments: dap.EvaluateArguments{Expression: "y", FrameId: frames[0].Id, Context: "repl"}})
+	if resp, ok := receive(t, ds).(*dap.ErrorResponse); !ok || resp.Success {
+		t.Fatal("expected error response for a variable of another frame")
+	}
+}
+
+func TestLaunchShowInternals(t *testing.T) {
+	ds := launchProgram(t, launchSource, `{"showInternals":true,"args":["x"]}`, dap.SourceBreakpoint{Line: 16})
+	if stopped, ok := receive(t, ds).(*dap.StoppedEvent); !ok || stopped.Body.Reason != "breakpoint" {
+		t.Fatal("expected stopped event at breakpoint")
+	}
+	ds.onScopesRequest(&dap.ScopesRequest{Request: dap.Request{Command: "scopes"}})
+	resp, ok := receive(t, ds).(*dap.ScopesResponse)
+	if !ok {
+		t.Fatal("expected scopes response")
+	}
+	names := map[string]bool{}
+	for _, each := range resp.Body.Scopes {
+		names[each.Name] = true
+	}
+	if !names["operands"] || !names["heap"] {
+		t.Errorf("missing internal scopes in %v", names)
+	}
+}
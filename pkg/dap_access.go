@@ -2,21 +2,56 @@ package pkg
 
 import (
 	"cmp"
+	"encoding/json"
 	"fmt"
-	"go/token"
 	"path/filepath"
+	"reflect"
 	"slices"
+	"sync"
 
 	"github.com/google/go-dap"
 )
 
+// StepPolicy decides what other goroutines do while one goroutine is stepped.
+type StepPolicy int
+
+const (
+	// FreezeOthers lets other goroutines take steps only while the stepped goroutine is waiting.
+	FreezeOthers StepPolicy = iota
+	// ContinueOthers schedules all goroutines as usual until the stepped goroutine has taken a step.
+	ContinueOthers
+)
+
 type DAPAccess struct {
-	vm *VM
+	// guards the VM ; a program can run in the background while requests are handled
+	mutex sync.Mutex
+	vm    *VM
+	// StepPolicy is used by StepThread
+	StepPolicy StepPolicy
+	// frame of the last Scopes request, used by Variables
+	selectedFrame *stackFrame
+	// line breakpoints by absolute file name
+	breakpoints         map[string][]*Breakpoint
+	functionBreakpoints []*Breakpoint
+	// watchable variables and fields by data id, see DataBreakpointInfo
+	dataLocations map[string]dataLocation
+	// targets of the last GotoTargets request, by id minus one
+	gotoTargets []gotoTarget
+	// targets of the last StepInTargets request, by id minus one
+	stepInTargets []stepInTarget
+	// functions of which instruction addresses were reported, by number minus one
+	funcs []Func
+	// Log receives messages of logpoints and failed breakpoint conditions ; optional
+	Log func(text string)
+	// InternalScopes adds the scopes of the operand stack of a frame and of the heap to those returned by Scopes
+	InternalScopes bool
 }
 
 // NewDAPAccess creates a new wrapper around a VM instance
 // to access DAP (Debug Adapter Protocol) data and control.
 func NewDAPAccess(vm *VM) *DAPAccess {
+	// frames can be restarted
+	vm.keepCallArgs = true
 	return &DAPAccess{
 		vm: vm,
 	}
@@ -24,50 +59,601 @@ func NewDAPAccess(vm *VM) *DAPAccess {
 
 // Launch starts execution of the given function on the underlying VM with the provided arguments.
 func (a *DAPAccess) Launch(functionName string, args []any) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	a.vm.Launch(functionName, args)
 }
 
+// LaunchWithJSON starts execution of a package function with arguments from a JSON array,
+// decoded to the types of its parameters.
+func (a *DAPAccess) LaunchWithJSON(functionName string, args json.RawMessage) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	values, err := a.vm.decodeArgs(functionName, args)
+	if err != nil {
+		return err
+	}
+	a.vm.Launch(functionName, values)
+	return nil
+}
+
+// Results returns the values returned by the launched function once it has ended.
+func (a *DAPAccess) Results() []any {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.vm.results()
+}
+
+// ExitCode returns the code passed to os.Exit by the program ; see WithOsExit.
+func (a *DAPAccess) ExitCode() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.vm.ExitCode()
+}
+
 // Next advances the VM by a single debugging step.
+// A panic that is not recovered by the program is returned as an error.
 func (a *DAPAccess) Next() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.next()
+}
+
+func (a *DAPAccess) next() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
 	return a.vm.Next()
 }
 
-// Threads reports the list of active debugger threads.
-func (a *DAPAccess) Threads() []dap.Thread {
-	return []dap.Thread{
-		{
-			Id:   1,
-			Name: "main",
-		},
+// Continue advances the VM until pause returns true, which is checked between steps, or a breakpoint is hit.
+// It returns the reason for stopping or the error of the last step, e.g. io.EOF when the program has ended.
+func (a *DAPAccess) Continue(pause func() bool) (reason string, err error) {
+	// the line of the next step is not entered again
+	a.mutex.Lock()
+	a.vm.enterLine()
+	if a.vm.watch != nil {
+		a.vm.watch.written = nil
+	}
+	a.mutex.Unlock()
+	for {
+		if pause() {
+			return "pause", nil
+		}
+		if err := a.Next(); err != nil {
+			if _, ok := err.(*PanicStop); ok {
+				return "exception", nil
+			}
+			return "", err
+		}
+		if a.isDataWritten() {
+			return "data breakpoint", nil
+		}
+		if reason := a.atBreakpoint(); reason != "" {
+			return reason, nil
+		}
+	}
+}
+
+// CanStepBack returns whether the VM records its steps, see WithRecording.
+func (a *DAPAccess) CanStepBack() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.vm.journal != nil
+}
+
+// StepBack restores the VM to the state before its last step.
+func (a *DAPAccess) StepBack() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.vm.StepBack()
+}
+
+// ReverseContinue restores the VM step by step until pause returns true, which is checked between steps,
+// or a breakpoint is hit going backwards. It returns the reason for stopping ; "entry" if no recorded step is left.
+func (a *DAPAccess) ReverseContinue(pause func() bool) (reason string, err error) {
+	a.mutex.Lock()
+	if a.vm.watch != nil {
+		a.vm.watch.written = nil
+	}
+	a.mutex.Unlock()
+	for {
+		if pause() {
+			return "pause", nil
+		}
+		reason, err := a.stepBack()
+		if err == errNoHistory {
+			return "entry", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if reason != "" {
+			return reason, nil
+		}
+	}
+}
+
+// stepBack undoes the last step and returns the reason to stop because that step wrote a watched variable or field,
+// entered the line of a breakpoint or the first line of a function with a breakpoint ; empty if it must not stop.
+func (a *DAPAccess) stepBack() (reason string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// values written by the step, to describe the change of a watched location
+	var keys []raceKey
+	var news []reflect.Value
+	if a.vm.journal != nil && a.vm.watch != nil && a.vm.journal.top() != nil {
+		for _, each := range a.vm.journal.top().written {
+			if _, ok := a.vm.watch.watches[each]; ok {
+				keys = append(keys, each)
+				news = append(news, a.vm.valueAt(each))
+			}
+		}
+	}
+	if err := a.vm.StepBack(); err != nil {
+		return "", err
+	}
+	if a.vm.watch != nil {
+		for i, each := range keys {
+			a.vm.watch.write(each, a.vm.valueAt(each), news[i])
+		}
+		if w := a.vm.watch.written; w != nil {
+			if a.isHitBackwards(w.Breakpoint) {
+				return "data breakpoint", nil
+			}
+			a.vm.watch.written = nil
+		}
+	}
+	return a.atBreakpointBackwards(), nil
+}
+
+// atBreakpointBackwards returns the reason to stop because the step that was undone last entered the line of the
+// next step and that line has a breakpoint, or the step called a function with a breakpoint ; empty if it must not stop.
+func (a *DAPAccess) atBreakpointBackwards() string {
+	if len(a.breakpoints) == 0 && len(a.functionBreakpoints) == 0 {
+		return ""
+	}
+	frame := a.vm.currentFrame
+	if frame == nil {
+		return ""
+	}
+	p := a.vm.positionOf(frame, frame.step)
+	if !p.IsValid() {
+		return ""
+	}
+	// the step before is the one that is undone next
+	called := false
+	if e := a.vm.journal.top(); e != nil {
+		before, ok := e.frameStateOf(frame)
+		if ok && e.currentFrame == frame && a.vm.positionOf(frame, before.step).Line == p.Line {
+			return ""
+		}
+		called = !ok
+	}
+	reason := ""
+	if fn, ok := frame.callee.(*FuncDecl); ok && called {
+		name := a.vm.funcName(fn)
+		for _, each := range a.functionBreakpoints {
+			if each.matchesFunction(name) && a.isHitBackwards(each) {
+				reason = "function breakpoint"
+			}
+		}
+	}
+	for _, each := range a.breakpoints[p.Filename] {
+		if each.Line == p.Line && a.isHitBackwards(each) {
+			reason = "breakpoint"
+		}
+	}
+	return reason
+}
+
+// isHitBackwards returns whether the VM must stop at a breakpoint that is hit going backwards.
+// Only the condition is checked ; hits are not counted and logpoints are not logged again.
+func (a *DAPAccess) isHitBackwards(bp *Breakpoint) bool {
+	if bp.LogMessage != "" {
+		return false
+	}
+	if bp.Condition == "" {
+		return true
+	}
+	ok, err := a.vm.evalCondition(bp.Condition)
+	return err != nil || ok
+}
+
+// RestartFrame removes the frames above a frame of the current goroutine and calls its function again
+// with the arguments of the original call.
+func (a *DAPAccess) RestartFrame(frameId int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, each := range a.vm.callStack {
+		if each.id == frameId {
+			return a.vm.restartFrame(each)
+		}
+	}
+	return fmt.Errorf("no frame with id %d in the current goroutine", frameId)
+}
+
+// GotoTargets returns the statements on a line of a source file to which the execution of the current frame can jump with Goto.
+func (a *DAPAccess) GotoTargets(path string, line int) (targets []dap.GotoTarget) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.gotoTargets = a.vm.gotoTargets(filepath.Clean(path), line)
+	for i, each := range a.gotoTargets {
+		targets = append(targets, dap.GotoTarget{
+			Id:     i + 1,
+			Label:  fmt.Sprintf("%s:%d:%d", filepath.Base(each.position.Filename), each.position.Line, each.position.Column),
+			Line:   each.position.Line,
+			Column: each.position.Column,
+		})
+	}
+	return
+}
+
+// Goto moves the execution of the current frame to a target of the last GotoTargets request.
+func (a *DAPAccess) Goto(targetId int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if targetId < 1 || targetId > len(a.gotoTargets) {
+		return fmt.Errorf("no goto target with id %d", targetId)
 	}
+	return a.vm.gotoStep(a.gotoTargets[targetId-1])
 }
 
-// StackFrames returns the current call stack for the selected thread.
-func (a *DAPAccess) StackFrames(dap.StackTraceArguments) (frames []dap.StackFrame) {
-	for _, eachFrame := range a.vm.callStack {
-		var tokloc token.Position
-		if eachFrame.callee != nil {
-			tokloc = a.vm.pkg.Fset.Position(eachFrame.callee.pos())
+// BreakpointLocations returns the positions in a source file from line to endLine at which a line breakpoint stops.
+func (a *DAPAccess) BreakpointLocations(path string, line, endLine int) (locations []dap.BreakpointLocation) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, each := range a.vm.breakpointLocations(filepath.Clean(path), line, endLine) {
+		locations = append(locations, dap.BreakpointLocation{Line: each.Line, Column: each.Column})
+	}
+	return
+}
+
+// SetBreakpoints replaces all line breakpoints in a source file.
+func (a *DAPAccess) SetBreakpoints(path string, breakpoints []*Breakpoint) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.breakpoints == nil {
+		a.breakpoints = map[string][]*Breakpoint{}
+	}
+	path = filepath.Clean(path)
+	if len(breakpoints) == 0 {
+		delete(a.breakpoints, path)
+		return
+	}
+	a.breakpoints[path] = breakpoints
+}
+
+// SetFunctionBreakpoints replaces all function breakpoints.
+func (a *DAPAccess) SetFunctionBreakpoints(breakpoints []*Breakpoint) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.functionBreakpoints = breakpoints
+}
+
+// HasFunction returns whether an interpreted function or method matches the name of a function breakpoint.
+func (a *DAPAccess) HasFunction(bp *Breakpoint) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, each := range a.vm.funcDecls() {
+		if bp.matchesFunction(a.vm.funcName(each)) {
+			return true
 		}
+	}
+	return false
+}
+
+// dataLocation is a variable or field that can be watched by a data breakpoint.
+type dataLocation struct {
+	key  raceKey
+	name string
+}
+
+// DataBreakpointInfo returns the data id of a variable in the scope with the given reference of the frame selected by Scopes.
+// If the reference is zero then the variable is looked up in the current frame.
+// The name can select a field of a struct variable, e.g. "s.requests".
+func (a *DAPAccess) DataBreakpointInfo(variablesReference int, name string) (dataId string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	frame := a.selectedFrame
+	if frame == nil || !a.isLive(frame) {
+		frame = a.vm.currentFrame
+	}
+	if frame == nil {
+		return "", fmt.Errorf("no frame")
+	}
+	env := frame.env
+	for variablesReference != 0 && env != nil && env.depth() != variablesReference {
+		env = env.parent()
+	}
+	if env == nil {
+		return "", fmt.Errorf("no scope with reference %d", variablesReference)
+	}
+	key, err := a.vm.dataLocation(env, name)
+	if err != nil {
+		return "", err
+	}
+	if a.dataLocations == nil {
+		a.dataLocations = map[string]dataLocation{}
+	}
+	dataId = fmt.Sprintf("%d:%s", len(a.dataLocations)+1, name)
+	a.dataLocations[dataId] = dataLocation{key: key, name: name}
+	return dataId, nil
+}
+
+// SetDataBreakpoints replaces all data breakpoints. The program stops after a step that changed a watched variable or field.
+// It returns whether each breakpoint has a known data id.
+func (a *DAPAccess) SetDataBreakpoints(breakpoints []*Breakpoint) (verified []bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	watches := map[raceKey]*Breakpoint{}
+	for _, each := range breakpoints {
+		loc, ok := a.dataLocations[each.DataId]
+		verified = append(verified, ok)
+		if ok {
+			each.Data = loc.name
+			watches[loc.key] = each
+		}
+	}
+	a.vm.setWatches(watches)
+	return
+}
+
+// DataWrite returns the write at which the VM stopped for a data breakpoint ; nil if it did not stop for one.
+func (a *DAPAccess) DataWrite() *DataWrite {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.vm.watch == nil {
+		return nil
+	}
+	return a.vm.watch.written
+}
+
+// isDataWritten returns whether the last step wrote a watched variable or field and the VM must stop.
+// Otherwise the write is forgotten.
+func (a *DAPAccess) isDataWritten() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.vm.watch == nil || a.vm.watch.written == nil {
+		return false
+	}
+	if a.isHit(a.vm.watch.written.Breakpoint) {
+		return true
+	}
+	a.vm.watch.written = nil
+	return false
+}
+
+// atBreakpoint returns the reason to stop before taking the next step because the VM entered the line of a breakpoint
+// or the first line of a function with a breakpoint ; empty if it must not stop. Logpoints on that line are logged.
+func (a *DAPAccess) atBreakpoint() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.breakpointReason()
+}
+
+func (a *DAPAccess) breakpointReason() string {
+	if len(a.breakpoints) == 0 && len(a.functionBreakpoints) == 0 {
+		return ""
+	}
+	frame := a.vm.currentFrame
+	first := frame != nil && frame.line == 0
+	file, line, entered := a.vm.enterLine()
+	if !entered {
+		return ""
+	}
+	reason := ""
+	if first {
+		if fn, ok := frame.callee.(*FuncDecl); ok {
+			name := a.vm.funcName(fn)
+			for _, each := range a.functionBreakpoints {
+				if each.matchesFunction(name) && a.isHit(each) {
+					reason = "function breakpoint"
+				}
+			}
+		}
+	}
+	for _, each := range a.breakpoints[file] {
+		if each.Line == line && a.isHit(each) {
+			reason = "breakpoint"
+		}
+	}
+	return reason
+}
+
+// isHit returns whether the VM must stop at a breakpoint that is entered.
+// The hit is counted if the condition is true. A logpoint is logged instead of stopping.
+func (a *DAPAccess) isHit(bp *Breakpoint) bool {
+	if bp.Condition != "" {
+		ok, err := a.vm.evalCondition(bp.Condition)
+		if err != nil {
+			// stop to let the user fix the condition
+			a.log(fmt.Sprintf("breakpoint at %s: %v\n", bp, err))
+			return true
+		}
+		if !ok {
+			return false
+		}
+	}
+	if !bp.hit() {
+		return false
+	}
+	if bp.LogMessage != "" {
+		a.log(a.logMessage(bp) + "\n")
+		return false
+	}
+	return true
+}
+
+// logMessage returns the message of a logpoint with the values of its expressions.
+func (a *DAPAccess) logMessage(bp *Breakpoint) string {
+	message, _ := interpolate(bp.LogMessage, func(expr string) (string, error) {
+		v, err := a.vm.evalExpr(expr)
+		if err != nil {
+			return fmt.Sprintf("<%v>", err), nil
+		}
+		return stringOf(v), nil
+	})
+	return message
+}
+
+func (a *DAPAccess) log(text string) {
+	if a.Log != nil {
+		a.Log(text)
+	}
+}
+
+// SetExceptionBreakMode sets at which panics the VM stops.
+func (a *DAPAccess) SetExceptionBreakMode(mode ExceptionBreakMode) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.vm.exceptionBreak = mode
+}
+
+// ExceptionInfo returns the panic at which the VM stopped ; nil if it did not stop at a panic.
+func (a *DAPAccess) ExceptionInfo() *PanicStop {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.vm.pendingPanic
+}
+
+// CurrentThreadId returns the thread id of the goroutine that took the last step.
+func (a *DAPAccess) CurrentThreadId() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.vm.routine == nil {
+		return 1
+	}
+	return a.vm.routine.id
+}
+
+// StepThread advances the goroutine with the given thread id by a single debugging step.
+// What other goroutines do meanwhile depends on the StepPolicy.
+func (a *DAPAccess) StepThread(threadId int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.stepThread(threadId)
+}
+
+func (a *DAPAccess) stepThread(threadId int) error {
+	target := a.routineOf(threadId)
+	if target == nil {
+		return a.next()
+	}
+	if a.StepPolicy == FreezeOthers {
+		a.vm.focus = target
+		defer func() { a.vm.focus = nil }()
+	}
+	for {
+		if err := a.next(); err != nil {
+			return err
+		}
+		if a.vm.routine == target || !slices.Contains(a.vm.routines, target) {
+			return nil
+		}
+	}
+}
+
+// Threads reports the list of active debugger threads, one for each goroutine.
+// Each thread is named after the function that the goroutine started with.
+func (a *DAPAccess) Threads() (threads []dap.Thread) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if len(a.vm.routines) == 0 {
+		return []dap.Thread{{Id: 1, Name: "main"}}
+	}
+	for _, each := range a.vm.routines {
+		threads = append(threads, dap.Thread{Id: each.id, Name: a.threadName(each)})
+	}
+	return
+}
+
+func (a *DAPAccess) threadName(r *routine) string {
+	if r == a.vm.routines[0] {
+		return "main"
+	}
+	for _, each := range a.callStackOf(r) {
+		if each.callee != nil {
+			return a.vm.funcName(each.callee)
+		}
+	}
+	return fmt.Sprintf("goroutine %d", r.id)
+}
+
+// routineOf returns the goroutine of a thread ; nil if there are no goroutines or the thread is gone.
+func (a *DAPAccess) routineOf(threadId int) *routine {
+	for _, each := range a.vm.routines {
+		if each.id == threadId {
+			return each
+		}
+	}
+	return nil
+}
+
+// callStackOf returns the call stack of a routine ; the VM holds that of the running one.
+func (a *DAPAccess) callStackOf(r *routine) stack[*stackFrame] {
+	if r == nil || r == a.vm.routine {
+		return a.vm.callStack
+	}
+	return r.callStack
+}
+
+// frameOf returns the frame with the given id in any goroutine ; the current frame if not found.
+func (a *DAPAccess) frameOf(frameId int) *stackFrame {
+	stacks := []stack[*stackFrame]{a.vm.callStack}
+	for _, each := range a.vm.routines {
+		stacks = append(stacks, a.callStackOf(each))
+	}
+	for _, each := range stacks {
+		for _, frame := range each {
+			if frame.id == frameId {
+				return frame
+			}
+		}
+	}
+	return a.vm.currentFrame
+}
+
+// StackFrames returns the call stack of the selected thread, innermost frame first.
+// The position of a frame is that of its next step ; for a caller, that is the call.
+func (a *DAPAccess) StackFrames(args dap.StackTraceArguments) (frames []dap.StackFrame) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	callStack := a.callStackOf(a.routineOf(args.ThreadId))
+	for i := len(callStack) - 1; i >= 0; i-- {
+		eachFrame := callStack[i]
+		// skip the frame that launched the program
+		if eachFrame.callee == nil {
+			continue
+		}
+		tokloc := a.vm.positionOf(eachFrame, eachFrame.step)
 		dapFrame := dap.StackFrame{
-			Id:   eachFrame.id,
-			Name: stringOf(eachFrame.callee), // TODO
-			Source: &dap.Source{
-				Name: filepath.Base(tokloc.Filename),
-				Path: tokloc.Filename,
-			},
+			Id:     eachFrame.id,
+			Name:   a.vm.funcName(eachFrame.callee),
+			Source: a.vm.sourceOf(tokloc.Filename),
 			Line:   tokloc.Line,
 			Column: tokloc.Column,
 		}
-		dapFrame.InstructionPointerReference = fmt.Sprintf("%v", eachFrame.step)
+		dapFrame.InstructionPointerReference = a.instructionPointer(eachFrame)
 		frames = append(frames, dapFrame)
 	}
+	if args.StartFrame > 0 {
+		frames = frames[min(args.StartFrame, len(frames)):]
+	}
+	if args.Levels > 0 && args.Levels < len(frames) {
+		frames = frames[:args.Levels]
+	}
 	return
 }
 
-// Scopes describes the variable scopes that are available for the current stack frame.
-func (a *DAPAccess) Scopes(dap.ScopesArguments) (scopes []dap.Scope) {
-	here := a.vm.currentFrame.env
+// Scopes describes the variable scopes that are available for the selected stack frame.
+func (a *DAPAccess) Scopes(args dap.ScopesArguments) (scopes []dap.Scope) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.selectedFrame = a.frameOf(args.FrameId)
+	here := a.selectedFrame.env
 	for {
 		if here == nil {
 			break
@@ -77,12 +663,21 @@ func (a *DAPAccess) Scopes(dap.ScopesArguments) (scopes []dap.Scope) {
 	}
 	// reverse to have innermost scope last
 	slices.Reverse(scopes)
-	return
+	return a.appendExtraScopes(scopes, a.selectedFrame)
 }
 
-// Variables lists the variables for the provided scope reference.
+// Variables lists the variables for the provided scope reference of the stack frame selected by Scopes.
 func (a *DAPAccess) Variables(args dap.VariablesArguments) (vars []dap.Variable) {
-	here := a.vm.currentFrame.env
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	frame := a.selectedFrame
+	if frame == nil || !a.isLive(frame) {
+		frame = a.vm.currentFrame
+	}
+	if vars, ok := a.extraVariables(frame, args.VariablesReference); ok {
+		return vars
+	}
+	here := frame.env
 	for {
 		if here == nil {
 			break
@@ -97,3 +692,23 @@ func (a *DAPAccess) Variables(args dap.VariablesArguments) (vars []dap.Variable)
 	slices.SortFunc(vars, func(s1, s2 dap.Variable) int { return cmp.Compare(s1.Name, s2.Name) })
 	return
 }
+
+// Evaluate returns the value and type of a Go expression in the environment of a stack frame ; the current frame if 0.
+func (a *DAPAccess) Evaluate(expression string, frameId int) (value, typeName string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	frame := a.vm.currentFrame
+	if frameId != 0 {
+		frame = a.frameOf(frameId)
+	}
+	v, err := a.vm.evalExprIn(frame, expression)
+	if err != nil {
+		return "", "", err
+	}
+	return stringOf(v), typeNameOf(v), nil
+}
+
+// isLive returns true if the frame is on the call stack of any goroutine.
+func (a *DAPAccess) isLive(frame *stackFrame) bool {
+	return a.frameOf(frame.id) == frame
+}
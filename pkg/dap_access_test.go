@@ -1,6 +1,11 @@
 package pkg
 
 import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-dap"
@@ -33,3 +38,513 @@ func main(){
 		}
 	}
 }
+
+const workerSource = `package main
+
+func worker(c chan int) {
+	for i := 0; i < 3; i++ {
+		c <- i
+	}
+}
+func main() {
+	c := make(chan int)
+	go worker(c)
+	print(<-c)
+	print(<-c)
+	print(<-c)
+}`
+
+// stepUntilThreads steps until the number of threads is reached.
+func stepUntilThreads(t *testing.T, xs *DAPAccess, count int) {
+	t.Helper()
+	for len(xs.Threads()) < count {
+		if err := xs.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDAPAccessThreadPerGoroutine(t *testing.T) {
+	xs := NewDAPAccess(NewVM(buildPackage(t, workerSource)))
+	xs.Launch("main", nil)
+	stepUntilThreads(t, xs, 2)
+	// let the worker start
+	for range 10 {
+		xs.StepThread(2)
+	}
+	threads := xs.Threads()
+	if got, want := threads[0].Name, "main"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := threads[1].Name, "main.worker"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	mainFrames := xs.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	workerFrames := xs.StackFrames(dap.StackTraceArguments{ThreadId: 2})
+	if got, want := mainFrames[0].Name, "main"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+	if got, want := workerFrames[0].Name, "worker"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+	scopes := xs.Scopes(dap.ScopesArguments{FrameId: workerFrames[0].Id})
+	vars := xs.Variables(dap.VariablesArguments{VariablesReference: scopes[len(scopes)-1].VariablesReference})
+	if len(vars) == 0 {
+		t.Fatal("expected worker variables")
+	}
+}
+
+func TestDAPAccessStepFreezesOthers(t *testing.T) {
+	xs := NewDAPAccess(NewVM(buildPackage(t, workerSource)))
+	xs.Launch("main", nil)
+	stepUntilThreads(t, xs, 2)
+	// each step is taken by the worker ; main only runs while the worker waits
+	for range 5 {
+		if err := xs.StepThread(2); err != nil {
+			t.Fatal(err)
+		}
+		if xs.vm.routine.id != 2 {
+			t.Fatalf("got step in goroutine %d", xs.vm.routine.id)
+		}
+	}
+}
+
+func TestDAPAccessStepContinuesOthers(t *testing.T) {
+	xs := NewDAPAccess(NewVM(buildPackage(t, workerSource)))
+	xs.StepPolicy = ContinueOthers
+	collectPrintOutput(xs.vm)
+	xs.Launch("main", nil)
+	stepUntilThreads(t, xs, 2)
+	for {
+		if err := xs.StepThread(1); err != nil {
+			break
+		}
+	}
+	if got, want := xs.vm.output.String(), "012"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+const loopSource = `package main
+
+func square(x int) int {
+	return x * x
+}
+func main() {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		sum += square(i)
+	}
+	print(sum)
+}`
+
+// continueToBreakpoint launches main and continues until a breakpoint on line 9 of loopSource is hit.
+func continueToBreakpoint(t *testing.T, sb dap.SourceBreakpoint) *DAPAccess {
+	t.Helper()
+	sb.Line = 9
+	return continueTo(t, loopSource, sb)
+}
+
+// continueToBreakpointIn launches main and continues until a breakpoint on a line of the source is hit.
+func continueToBreakpointIn(t *testing.T, source string, line int) *DAPAccess {
+	t.Helper()
+	return continueTo(t, source, dap.SourceBreakpoint{Line: line})
+}
+
+func continueTo(t *testing.T, source string, sb dap.SourceBreakpoint) *DAPAccess {
+	t.Helper()
+	pkg := buildPackage(t, source)
+	xs := NewDAPAccess(NewVM(pkg))
+	bp, err := NewBreakpoint(pkg.GoFiles[0], sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs.SetBreakpoints(pkg.GoFiles[0], []*Breakpoint{bp})
+	xs.Launch("main", nil)
+	reason, err := xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	return xs
+}
+
+func evalString(t *testing.T, xs *DAPAccess, expr string) string {
+	t.Helper()
+	v, err := xs.vm.evalExpr(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stringOf(v)
+}
+
+var subpackageModule = map[string]string{
+	"go.mod": "module nested\n\ngo 1.24\n",
+	"main.go": `package main
+
+import "nested/calc"
+
+func main() {
+	print(calc.Sum())
+}`,
+	"calc/calc.go": `package calc
+
+func Sum() int {
+	total, n := 0, 4
+	for i := 0; i < n; i++ {
+		total += i
+	}
+	return total
+}`,
+}
+
+// continueInSubpackage continues to a breakpoint in the file of the subpackage calc.
+func continueInSubpackage(t *testing.T, sb dap.SourceBreakpoint) *DAPAccess {
+	t.Helper()
+	pkg, dir := buildModule(t, subpackageModule)
+	xs := NewDAPAccess(NewVM(pkg))
+	file := filepath.Join(dir, "calc", "calc.go")
+	bp, err := NewBreakpoint(file, sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs.SetBreakpoints(file, []*Breakpoint{bp})
+	xs.Launch("main", nil)
+	reason, err := xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	return xs
+}
+
+func TestDAPAccessConditionalBreakpointInSubpackage(t *testing.T) {
+	xs := continueInSubpackage(t, dap.SourceBreakpoint{Line: 6, Condition: "i == 2"})
+	if got, want := evalString(t, xs, "i"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestDAPAccessEvaluateInSubpackage(t *testing.T) {
+	xs := continueInSubpackage(t, dap.SourceBreakpoint{Line: 6, Condition: "i == 3"})
+	frames := xs.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	value, _, err := xs.Evaluate("total + n", frames[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0+1+2 and 4
+	if got, want := value, "7"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestDAPAccessConditionalBreakpoint(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{Condition: "i == 6"})
+	if got, want := evalString(t, xs, "i"), "6"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "sum + square(i)"), "91"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// evaluation leaves the program as it was
+	xs.Next()
+	if got, want := evalString(t, xs, "sum"), "55"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.Continue(func() bool { return false }); err != io.EOF {
+		t.Fatalf("got %v want EOF", err)
+	}
+}
+
+func TestDAPAccessHitConditionBreakpoint(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{HitCondition: "== 3"})
+	if got, want := evalString(t, xs, "i"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.Continue(func() bool { return false }); err != io.EOF {
+		t.Fatalf("got %v want EOF", err)
+	}
+}
+
+func TestDAPAccessLogpoint(t *testing.T) {
+	pkg := buildPackage(t, loopSource)
+	xs := NewDAPAccess(NewVM(pkg))
+	log := new(strings.Builder)
+	xs.Log = func(text string) { log.WriteString(text) }
+	bp, err := NewBreakpoint(pkg.GoFiles[0], dap.SourceBreakpoint{Line: 9, Condition: "i > 7", LogMessage: "square({i})={square(i)}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs.SetBreakpoints(pkg.GoFiles[0], []*Breakpoint{bp})
+	xs.Launch("main", nil)
+	if _, err := xs.Continue(func() bool { return false }); err != io.EOF {
+		t.Fatalf("got %v want EOF", err)
+	}
+	if got, want := log.String(), "square(8)=64\nsquare(9)=81\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestNewBreakpointErrors(t *testing.T) {
+	for _, each := range []dap.SourceBreakpoint{
+		{Condition: "i =="},
+		{HitCondition: "> x"},
+		{HitCondition: "% 0"},
+		{LogMessage: "i={i"},
+		{LogMessage: "i={i +}"},
+	} {
+		if _, err := NewBreakpoint("main.go", each); err == nil {
+			t.Errorf("expected error for %#v", each)
+		}
+	}
+}
+
+const serverSource = `package main
+
+type Server struct {
+	requests int
+}
+
+func (s *Server) Serve(path string) {
+	s.requests++
+	handle(path)
+}
+func handle(path string) {
+	print(path)
+}
+func main() {
+	s := new(Server)
+	s.Serve("/")
+	s.Serve("/about")
+}`
+
+// continueToFunction sets function breakpoints and continues until one is hit.
+func continueToFunction(t *testing.T, xs *DAPAccess, fbs ...dap.FunctionBreakpoint) {
+	t.Helper()
+	var bps []*Breakpoint
+	for _, each := range fbs {
+		bp, err := NewFunctionBreakpoint(each)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !xs.HasFunction(bp) {
+			t.Fatalf("no function %s", bp)
+		}
+		bps = append(bps, bp)
+	}
+	xs.SetFunctionBreakpoints(bps)
+	reason, err := xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "function breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestDAPAccessFunctionBreakpoint(t *testing.T) {
+	xs := NewDAPAccess(NewVM(buildPackage(t, serverSource)))
+	xs.Launch("main", nil)
+	continueToFunction(t, xs, dap.FunctionBreakpoint{Name: "(*Server).Serve", Condition: `path != "/"`})
+	if got, want := evalString(t, xs, "path"), "/about"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// the first statement is not taken yet
+	if got, want := evalString(t, xs, "s.requests"), "1"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	continueToFunction(t, xs, dap.FunctionBreakpoint{Name: "main.handle"})
+	frames := xs.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	if got, want := frames[0].Name, "handle"; !strings.Contains(got, want) {
+		t.Errorf("got %q want to contain %q", got, want)
+	}
+	if xs.HasFunction(&Breakpoint{Function: "main.missing"}) {
+		t.Error("expected no function main.missing")
+	}
+}
+
+func TestDAPAccessFunctionBreakpointInSubpackage(t *testing.T) {
+	cwd, _ := os.Getwd()
+	loc := path.Join(cwd, "../examples/nestedpkgs")
+	gopkg, err := LoadPackage(loc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(loc)
+	defer os.Chdir(cwd)
+	pkg, err := BuildPackage(gopkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs := NewDAPAccess(NewVM(pkg))
+	xs.Launch("main", nil)
+	continueToFunction(t, xs, dap.FunctionBreakpoint{Name: "pkgc.Print"})
+	frames := xs.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "pkgc.Print"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// main.main and pkgc.Print, innermost first
+	if got, want := len(frames), 2; got != want {
+		t.Fatalf("got %d want %d", got, want)
+	}
+	if got, want := frames[0].Name, "pkgc.Print"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := frames[1].Name, "main.main"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+const counterSource = `package main
+
+type Counter struct {
+	hits int
+}
+
+func (c *Counter) hit() {
+	c.hits++
+}
+func main() {
+	total := 0
+	c := new(Counter)
+	for i := 0; i < 3; i++ {
+		c.hit()
+		total += i
+	}
+	print(total)
+}`
+
+// continueToWrite continues until a data breakpoint is hit and returns the description of the write.
+func continueToWrite(t *testing.T, xs *DAPAccess) string {
+	t.Helper()
+	reason, err := xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "data breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	return xs.DataWrite().Description()
+}
+
+// watch sets a data breakpoint on a variable or field of the current frame.
+func watch(t *testing.T, xs *DAPAccess, name string, db dap.DataBreakpoint) {
+	t.Helper()
+	id, err := xs.DataBreakpointInfo(0, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DataId = id
+	bp, err := NewDataBreakpoint(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified := xs.SetDataBreakpoints([]*Breakpoint{bp}); !verified[0] {
+		t.Fatal("expected verified data breakpoint")
+	}
+}
+
+func TestDAPAccessDataBreakpointOnVariable(t *testing.T) {
+	xs := continueToBreakpointIn(t, counterSource, 14)
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], nil)
+	watch(t, xs, "total", dap.DataBreakpoint{})
+	// total += 0 does not change the value
+	if got, want := continueToWrite(t, xs), "total changed from 0 to 1"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := continueToWrite(t, xs), "total changed from 1 to 3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.Continue(func() bool { return false }); err != io.EOF {
+		t.Fatalf("got %v want EOF", err)
+	}
+}
+
+func TestDAPAccessDataBreakpointOnField(t *testing.T) {
+	xs := continueToBreakpointIn(t, counterSource, 14)
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], nil)
+	watch(t, xs, "c.hits", dap.DataBreakpoint{Condition: "c.hits == 2"})
+	if got, want := continueToWrite(t, xs), "c.hits changed from 1 to 2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// stopped in the method that wrote the field
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "main.(*Counter).hit"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.DataBreakpointInfo(0, "c.missing"); err == nil {
+		t.Error("expected error for missing field")
+	}
+}
+
+const restartSource = `package main
+
+type Point struct {
+	x int
+}
+
+func (p Point) scale(f int) int {
+	p.x = p.x * f
+	return p.x
+}
+func main() {
+	p := Point{x: 2}
+	print(p.scale(3))
+}`
+
+func TestDAPAccessRestartFrame(t *testing.T) {
+	xs := continueToBreakpointIn(t, restartSource, 9)
+	frame := xs.vm.currentFrame
+	if got, want := evalString(t, xs, "p.x"), "6"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if err := xs.RestartFrame(frame.id); err != nil {
+		t.Fatal(err)
+	}
+	// the receiver and argument of the call are restored
+	if got, want := evalString(t, xs, "p.x"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "f"), "3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	reason, err := xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "p.x"), "6"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if err := xs.RestartFrame(-1); err == nil {
+		t.Error("expected error for unknown frame")
+	}
+}
+
+func TestDAPAccessRestartCallerFrame(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{Condition: "i == 4"})
+	// restart main from the frame of square
+	for len(xs.vm.callStack) < 3 {
+		if err := xs.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "main.square"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	main := xs.vm.callStack[len(xs.vm.callStack)-2]
+	if err := xs.RestartFrame(main.id); err != nil {
+		t.Fatal(err)
+	}
+	if xs.vm.currentFrame != main {
+		t.Error("expected main frame")
+	}
+	if _, err := xs.vm.evalExpr("sum"); err == nil {
+		t.Error("expected sum to be undefined before its declaration")
+	}
+}
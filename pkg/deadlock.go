@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// DeadlockError is returned by the VM when all interpreted routines are waiting
+// and none of them can ever continue.
+type DeadlockError struct {
+	Stacks string // goroutine dump with the position where each routine is blocked
+}
+
+func (e DeadlockError) Error() string {
+	return "all goroutines are asleep - deadlock!\n\n" + e.Stacks
+}
+
+// trackChannel remembers a channel made by the interpreter.
+// Only routines waiting for such channels can be part of a deadlock.
+func (vm *VM) trackChannel(ch reflect.Value) {
+	if vm.channels == nil {
+		vm.channels = map[any]bool{}
+	}
+	vm.channels[ch.Interface()] = true
+}
+
+// escapeChannels marks the channels in the arguments of an SDK call ;
+// SDK code may send or receive on these at any time.
+func (vm *VM) escapeChannels(args []reflect.Value) {
+	if vm.channels == nil {
+		return
+	}
+	for _, each := range args {
+		if each.IsValid() && each.Kind() == reflect.Chan && !each.IsNil() {
+			vm.channels[each.Interface()] = false
+		}
+	}
+}
+
+// isDeadlocked returns true if all routines are waiting and none of the waits can be completed by SDK code.
+func (vm *VM) isDeadlocked() bool {
+	for _, each := range vm.routines {
+		if !each.isWaiting() || each.waitKind == waitSDK {
+			return false
+		}
+		if each.waitKind == waitRoutines {
+			continue
+		}
+		for _, c := range each.wait {
+			if !isChannelCase(c) {
+				// blocks forever
+				continue
+			}
+			if !vm.channels[c.Chan.Interface()] {
+				// channel is not made by the interpreter or escaped to SDK code
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// deadlockError returns the error with a dump of all routines in the format of the Go runtime.
+func (vm *VM) deadlockError() error {
+	// make sure the running routine has its call stack saved
+	vm.routine.callStack, vm.routine.currentFrame = vm.callStack, vm.currentFrame
+	buf := new(strings.Builder)
+	for i, each := range vm.routines {
+		if i > 0 {
+			fmt.Fprintln(buf)
+		}
+		vm.writeRoutineStack(buf, each)
+	}
+	return DeadlockError{Stacks: buf.String()}
+}
+
+// writeRoutineStack writes the frames of a routine, innermost first.
+func (vm *VM) writeRoutineStack(buf *strings.Builder, r *routine) {
+	fmt.Fprintf(buf, "goroutine %d [%s]:\n", r.id, r.waitReason)
+	vm.writeFrames(buf, vm.stackLocations(r.callStack, r.waitPos), "")
+	if r.goPos != token.NoPos {
+		fmt.Fprintf(buf, "created by %s in goroutine %d\n", vm.funcName(r.goFunc), r.parentId)
+		fmt.Fprintf(buf, "\t%s\n", vm.positionString(r.goPos))
+	}
+}
+
+// frameLocation is the function and position of a frame in a call stack.
+type frameLocation struct {
+	callee Func
+	pos    token.Pos
+}
+
+// stackLocations returns the locations of the frames of a call stack, innermost first.
+// The position of the innermost frame is given ; the others are at the step that made the call.
+func (vm *VM) stackLocations(callStack stack[*stackFrame], topPos token.Pos) (locations []frameLocation) {
+	for i := len(callStack) - 1; i >= 0; i-- {
+		frame := callStack[i]
+		if frame.callee == nil {
+			continue
+		}
+		pos := token.NoPos
+		if i == len(callStack)-1 {
+			pos = topPos
+		} else if frame.step != nil {
+			pos = frame.step.pos()
+		}
+		locations = append(locations, frameLocation{callee: frame.callee, pos: pos})
+	}
+	return
+}
+
+// writeFrames writes each location as a function line and an indented position line.
+func (vm *VM) writeFrames(buf *strings.Builder, locations []frameLocation, indent string) {
+	for _, each := range locations {
+		fmt.Fprintf(buf, "%s%s(...)\n", indent, vm.funcName(each.callee))
+		fmt.Fprintf(buf, "%s\t%s\n", indent, vm.positionString(each.pos))
+	}
+}
+
+// funcName returns the qualified name of an interpreted function as used in stack traces: main.main, main.T.M or
+// main.(*T).M for a method, and main.main.func1 for the first function literal in main.
+func (vm *VM) funcName(f Func) string {
+	switch fn := f.(type) {
+	case *FuncDecl:
+		pkgName := vm.packageOf(fn).Name
+		if fn.recv != nil && len(fn.recv.List) > 0 {
+			switch rt := fn.recv.List[0].typ.(type) {
+			case StarExpr:
+				if id, ok := rt.x.(Ident); ok {
+					return fmt.Sprintf("%s.(*%s).%s", pkgName, id.name, fn.funcName.name)
+				}
+			case Ident:
+				return fmt.Sprintf("%s.%s.%s", pkgName, rt.name, fn.funcName.name)
+			}
+		}
+		return fmt.Sprintf("%s.%s", pkgName, fn.funcName.name)
+	case *FuncLit:
+		if fn.name != "" {
+			return fn.name
+		}
+		return fmt.Sprintf("%s.func", vm.pkg.Name)
+	}
+	return "?"
+}
+
+// packageOf returns the package, the main one or one of its subpackages, in which a function is declared.
+func (vm *VM) packageOf(fn *FuncDecl) *Package {
+	for _, each := range vm.pkg.env.packages {
+		if fn.env == Env(each.env) {
+			return each
+		}
+	}
+	return vm.pkg
+}
+
+func (vm *VM) positionString(pos token.Pos) string {
+	if pos == token.NoPos {
+		return "<no position info>"
+	}
+	loc := vm.pkg.Fset.Position(pos)
+	return fmt.Sprintf("%s:%d", loc.Filename, loc.Line)
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-dap"
+)
+
+// The steps of the call graph of a function are the instructions of the VM. The address of an instruction holds
+// the number of its function, see DAPAccess.funcs, in the high 32 bits and its index in the low 32 bits.
+// Indexes start at instructionBase to leave room for addresses before the first instruction.
+const instructionBase = 1 << 16
+
+// instructionsOf returns the steps of the call graph of a function ordered by id, which is the order in which
+// they were built from the source.
+func (vm *VM) instructionsOf(fn Func) (steps []Step) {
+	var head Step
+	switch f := fn.(type) {
+	case *FuncDecl:
+		head = f.callGraph
+	case *FuncLit:
+		head = f.callGraph
+	}
+	if head == nil {
+		return nil
+	}
+	for _, each := range vm.flowOf(&stackFrame{callee: fn}, head) {
+		steps = append(steps, each.step)
+	}
+	slices.SortStableFunc(steps, func(a, b Step) int { return cmp.Compare(a.ID(), b.ID()) })
+	return
+}
+
+// instructionPointer returns the address of the next step of a frame ; empty if the step is not in the call graph
+// of its function, such as when the frame runs a deferred call.
+func (a *DAPAccess) instructionPointer(frame *stackFrame) string {
+	if frame.callee == nil || frame.step == nil {
+		return ""
+	}
+	index := slices.Index(a.vm.instructionsOf(frame.callee), frame.step)
+	if index == -1 {
+		return ""
+	}
+	return a.addressOf(frame.callee, index)
+}
+
+func (a *DAPAccess) addressOf(fn Func, index int) string {
+	number := slices.Index(a.funcs, fn) + 1
+	if number == 0 {
+		a.funcs = append(a.funcs, fn)
+		number = len(a.funcs)
+	}
+	return fmt.Sprintf("0x%x", uint64(number)<<32|uint64(instructionBase+index))
+}
+
+// Disassemble returns the steps around the one at a memory reference, as reported by the instruction pointer
+// reference of a stack frame. Positions before the first or after the last step of the function are invalid
+// instructions.
+func (a *DAPAccess) Disassemble(args dap.DisassembleArguments) ([]dap.DisassembledInstruction, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	address, err := strconv.ParseUint(args.MemoryReference, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory reference %q", args.MemoryReference)
+	}
+	address += uint64(args.Offset)
+	number := int(address >> 32)
+	if number < 1 || number > len(a.funcs) {
+		return nil, fmt.Errorf("unknown memory reference %q", args.MemoryReference)
+	}
+	fn := a.funcs[number-1]
+	frame := &stackFrame{callee: fn}
+	symbol := a.vm.funcName(fn)
+	steps := a.vm.instructionsOf(fn)
+	start := int(address&0xffffffff) - instructionBase + args.InstructionOffset
+	instructions := make([]dap.DisassembledInstruction, 0, args.InstructionCount)
+	for index := start; index < start+args.InstructionCount; index++ {
+		if index < -instructionBase {
+			instructions = append(instructions, dap.DisassembledInstruction{Address: "0x0", Instruction: "??"})
+			continue
+		}
+		each := dap.DisassembledInstruction{Address: a.addressOf(fn, index), Instruction: "??"}
+		if index >= 0 && index < len(steps) {
+			step := steps[index]
+			each.Instruction = strings.TrimSpace(fmt.Sprint(step))
+			each.Symbol = symbol
+			if p := a.vm.positionOf(frame, step); p.IsValid() {
+				each.Location = a.vm.sourceOf(p.Filename)
+				each.Line = p.Line
+				each.Column = p.Column
+			}
+		}
+		instructions = append(instructions, each)
+	}
+	return instructions, nil
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+func instructionPointer(t *testing.T, xs *DAPAccess) string {
+	t.Helper()
+	frames := xs.StackFrames(dap.StackTraceArguments{})
+	ip := frames[0].InstructionPointerReference
+	if ip == "" {
+		t.Fatal("expected instruction pointer reference")
+	}
+	return ip
+}
+
+func TestDisassembleAroundInstructionPointer(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{})
+	ip := instructionPointer(t, xs)
+	instructions, err := xs.Disassemble(dap.DisassembleArguments{MemoryReference: ip, InstructionOffset: -2, InstructionCount: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(instructions), 5; got != want {
+		t.Fatalf("got %d want %d", got, want)
+	}
+	current := instructions[2]
+	if got, want := current.Address, ip; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := current.Line, 9; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if got, want := current.Symbol, "main.main"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if current.Location == nil || current.Instruction == "??" {
+		t.Errorf("unexpected instruction %#v", current)
+	}
+	if instructions[1].Address == ip || instructions[3].Address == ip {
+		t.Error("expected distinct addresses")
+	}
+}
+
+func TestDisassembleOutsideFunction(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{})
+	ip := instructionPointer(t, xs)
+	instructions, err := xs.Disassemble(dap.DisassembleArguments{MemoryReference: ip, InstructionOffset: -1000, InstructionCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := instructions[0].Instruction, "??"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.Disassemble(dap.DisassembleArguments{MemoryReference: "main", InstructionCount: 1}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStepInstructionAndLine(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{})
+	frame := xs.vm.currentFrame
+	// the first step of the line evaluates an operand of the assignment
+	if err := xs.StepThread(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := xs.vm.positionOf(frame, xs.vm.currentFrame.step).Line, 9; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	// the line calls square
+	if err := xs.StepLine(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "main.square"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -43,7 +43,8 @@ type Env interface {
 
 type PkgEnvironment struct {
 	Env
-	declarations []Stmt
+	declarations []Stmt      // const declarations, and var declarations until sorted
+	variables    []ValueSpec // var declarations in initialization order
 	inits        []*FuncDecl
 	methods      []*FuncDecl
 	packages     map[string]*Package // path -> *Package
@@ -129,6 +130,9 @@ func (p *PkgEnvironment) appendVariables(vars []dap.Variable) []dap.Variable {
 		if _, ok := v.Interface().(SDKPackage); ok {
 			continue
 		}
+		if _, ok := v.Interface().(*Package); ok {
+			continue
+		}
 		vars = append(vars, dap.Variable{
 			Name:               k,
 			Value:              stringOf(v),
@@ -151,12 +155,14 @@ type Environment struct {
 	parentEnv Env
 	values    map[string]reflect.Value
 	isShared  bool
+	journal   *journal // non-nil if writes are recorded for stepping back
 }
 
 func newEnvironment(parentOrNil Env) Env {
 	return &Environment{
 		parentEnv: parentOrNil,
 		values:    map[string]reflect.Value{},
+		journal:   journalOf(parentOrNil),
 	}
 }
 
@@ -259,6 +265,9 @@ func (e *Environment) valueSet(name string, value reflect.Value) {
 	if name == "_" {
 		return
 	}
+	if e.journal != nil {
+		e.journal.recordSet(e, name)
+	}
 	e.values[name] = value
 	// trace after set
 	if trace {
@@ -266,6 +275,9 @@ func (e *Environment) valueSet(name string, value reflect.Value) {
 	}
 }
 func (e *Environment) valueUnset(name string) {
+	if e.journal != nil {
+		e.journal.recordSet(e, name)
+	}
 	delete(e.values, name)
 }
 
@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+)
+
+// parseExpr parses the source of a Go expression as used by debuggers, e.g. in breakpoint conditions.
+func parseExpr(source string) (ast.Expr, error) {
+	expr, err := parser.ParseExprFrom(token.NewFileSet(), "", source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", source, err)
+	}
+	return expr, nil
+}
+
+// evalExpr returns the value of a Go expression in the environment of the current frame.
+// The expression is type checked in the scope of the position of the next step so it can refer to
+// local variables, package variables, functions and imported packages.
+// The VM is left as it was ; frames pushed by calls in the expression are removed.
+func (vm *VM) evalExpr(source string) (reflect.Value, error) {
+	return vm.evalExprIn(vm.currentFrame, source)
+}
+
+// evalExprIn returns the value of a Go expression in the environment of a frame, which can be that of a caller
+// or of another goroutine. The expression is type checked in the scope of the position of the next step of the frame,
+// in the package of its function, which can be a subpackage.
+func (vm *VM) evalExprIn(frame *stackFrame, source string) (result reflect.Value, err error) {
+	if frame == nil || frame.step == nil {
+		return reflect.Value{}, errors.New("no frame to evaluate in")
+	}
+	expr, err := parseExpr(source)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Instances:  map[*ast.Ident]types.Instance{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	p := vm.packageOfFrame(frame)
+	if err := types.CheckExpr(p.Fset, p.typesPackage(), frame.step.pos(), expr, info); err != nil {
+		if terr, ok := err.(types.Error); ok {
+			return reflect.Value{}, fmt.Errorf("invalid expression %q: %s", source, terr.Msg)
+		}
+		return reflect.Value{}, fmt.Errorf("invalid expression %q: %v", source, err)
+	}
+
+	// build with the type information of the expression only
+	goPkg := *p.Package
+	goPkg.TypesInfo = info
+	b := newASTBuilder(&goPkg)
+	b.Visit(expr)
+	if b.Err() != nil {
+		return reflect.Value{}, b.Err()
+	}
+	head := b.pop().(Expr).flow(newGraphBuilder(&goPkg))
+
+	// accesses by the debugger are not part of the program
+	race := vm.race
+	vm.race = nil
+
+	// take the steps in a frame of its own with access to the environment of the frame
+	top := vm.currentFrame
+	next := top.step
+	vm.pushNewFrame(nil)
+	eval := vm.currentFrame
+	eval.env.(*Environment).parentEnv = frame.env
+	eval.step = head
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		for vm.currentFrame != eval {
+			vm.popFrame()
+		}
+		vm.popFrame()
+		top.step = next
+		vm.race = race
+	}()
+	for vm.currentFrame != eval || eval.step != nil {
+		vm.currentFrame.step.take(vm)
+	}
+	return deref(vm, vm.popOperand()), nil
+}
+
+// evalCondition returns the value of a boolean Go expression in the environment of the current frame.
+func (vm *VM) evalCondition(source string) (bool, error) {
+	v, err := vm.evalExpr(source)
+	if err != nil {
+		return false, err
+	}
+	if v.Kind() != reflect.Bool {
+		return false, fmt.Errorf("condition %q is not a boolean but %s", source, v.Kind())
+	}
+	return v.Bool(), nil
+}
+
+// typesPackage returns the type checked package, which is not loaded itself, from any of its definitions.
+func (p *Package) typesPackage() *types.Package {
+	if p.Types != nil {
+		return p.Types
+	}
+	for _, obj := range p.TypesInfo.Defs {
+		if obj != nil && obj.Pkg() != nil {
+			return obj.Pkg()
+		}
+	}
+	return nil
+}
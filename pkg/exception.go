@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExceptionBreakMode decides at which panics the VM stops, before deferred functions run.
+type ExceptionBreakMode int
+
+const (
+	BreakOnNoPanics ExceptionBreakMode = iota
+	// stop at every panic, also when it is recovered
+	BreakOnAllPanics
+	// stop at panics that are not recovered
+	BreakOnUncaughtPanics
+)
+
+// WithExceptionBreak makes the VM stop at panics of a mode ; CallPackageFunction then returns the *PanicStop.
+func WithExceptionBreak(mode ExceptionBreakMode) VMOption {
+	return func(vm *VM) {
+		vm.exceptionBreak = mode
+	}
+}
+
+// PanicStop is returned by VM.Next when it stopped at the step that raised a panic.
+// The call stack is intact ; the next call to Next continues the panic.
+type PanicStop struct {
+	Value    any
+	Uncaught bool   // true if no deferred function of the current frame recovers
+	Stack    string // goroutine trace in the format of the Go runtime
+}
+
+func (p PanicStop) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// TypeName returns the Go type of the panic value.
+func (p PanicStop) TypeName() string {
+	if sv, ok := p.Value.(StructValue); ok {
+		return sv.structType.name
+	}
+	return fmt.Sprintf("%T", p.Value)
+}
+
+// stopAtPanic returns whether the VM must stop at a panic given the break mode.
+func (vm *VM) stopAtPanic(recovered bool) bool {
+	switch vm.exceptionBreak {
+	case BreakOnAllPanics:
+		return true
+	case BreakOnUncaughtPanics:
+		return !recovered
+	}
+	return false
+}
+
+// panicStop returns the stop for a panic raised by the current step.
+func (vm *VM) panicStop(value any, recovered bool) *PanicStop {
+	buf := new(strings.Builder)
+	id := 1
+	if vm.routine != nil {
+		id = vm.routine.id
+	}
+	fmt.Fprintf(buf, "goroutine %d [running]:\n", id)
+	vm.writeFrames(buf, vm.stackLocations(vm.callStack, vm.currentFrame.step.pos()), "")
+	return &PanicStop{Value: value, Uncaught: !recovered, Stack: buf.String()}
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStopAtRecoveredPanic(t *testing.T) {
+	vm := NewVM(buildPackage(t, `package main
+
+func main() {
+	defer func() {
+		print(recover())
+	}()
+	print("before")
+	panic("boom")
+}`))
+	collectPrintOutput(vm)
+	vm.exceptionBreak = BreakOnAllPanics
+	vm.launch("main", nil)
+	stops := 0
+	for {
+		err := vm.Next()
+		if err == io.EOF {
+			break
+		}
+		if p, ok := err.(*PanicStop); ok {
+			stops++
+			if p.Value != "boom" || p.Uncaught {
+				t.Errorf("unexpected stop %#v", p)
+			}
+			// deferred functions have not run yet
+			if got, want := vm.output.String(), "before"; got != want {
+				t.Errorf("got %q want %q", got, want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stops != 1 {
+		t.Errorf("got %d stops", stops)
+	}
+	if got, want := vm.output.String(), "beforeboom"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestCallPackageFunctionUncaughtPanic(t *testing.T) {
+	pkg := buildPackage(t, `package main
+
+func fail() {
+	panic("boom")
+}
+
+func main() {
+	fail()
+}`)
+	_, err := CallPackageFunction(pkg, "main", nil, WithExceptionBreak(BreakOnUncaughtPanics))
+	p, ok := err.(*PanicStop)
+	if !ok {
+		t.Fatalf("got %v", err)
+	}
+	if got, want := p.Error(), "panic: boom"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := p.Stack, "main.fail(...)"; !strings.Contains(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -137,6 +137,7 @@ var _ Func = (*FuncLit)(nil)
 type FuncLit struct {
 	Type      *FuncType
 	Body      *BlockStmt // TODO not sure what to do when Body and/or Type is nil
+	name      string     // qualified name as numbered by the Go compiler, e.g. main.main.func1 ; empty if unknown
 	callGraph Step
 	// goto targets
 	labelToStmt  map[string]stmtReference // TODO lazy initialization
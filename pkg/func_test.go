@@ -1,6 +1,9 @@
 package pkg
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func TestFunc(t *testing.T) {
 	//setAttr(t, "dot", true)
@@ -60,3 +63,34 @@ func main() {
 	print(f())
 }`, "1")
 }
+
+func TestFuncLitNames(t *testing.T) {
+	goPkg, err := ParseSource(`package main
+
+type T struct{}
+
+func (*T) M() {
+	_ = func() {}
+}
+
+var f = func() {}
+
+func main() {
+	_ = func() {
+		_ = func() {}
+	}
+	_ = func() {}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, each := range funcLitNames(goPkg) {
+		got = append(got, each)
+	}
+	slices.Sort(got)
+	want := []string{"main.(*T).M.func1", "main.init.func1", "main.main.func1", "main.main.func1.1", "main.main.func2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
@@ -169,6 +169,8 @@ func (d genericsDetector) Visit(node ast.Node) ast.Visitor {
 		d.Visit(n.X)
 	case *ast.DeferStmt:
 		d.Visit(n.Call)
+	case *ast.GoStmt:
+		d.Visit(n.Call)
 	case *ast.KeyValueExpr:
 		d.Visit(n.Key)
 		d.Visit(n.Value)
@@ -201,6 +203,13 @@ func (d genericsDetector) Visit(node ast.Node) ast.Visitor {
 		for _, each := range n.Body {
 			d.Visit(each)
 		}
+	case *ast.SelectStmt:
+		d.Visit(n.Body)
+	case *ast.CommClause:
+		d.Visit(n.Comm)
+		for _, each := range n.Body {
+			d.Visit(each)
+		}
 	case *ast.TypeAssertExpr:
 		d.Visit(n.X)
 	case *ast.MapType:
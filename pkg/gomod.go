@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
@@ -21,6 +22,25 @@ func LoadGoMod(filename string) (*modfile.File, error) {
 	return modFile, nil
 }
 
+// moduleOf returns the path and directory of the module that contains a directory, by its go.mod file.
+func moduleOf(dir string) (modulePath, moduleDir string, ok bool) {
+	for {
+		filename := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(filename); err == nil {
+			modFile, err := LoadGoMod(filename)
+			if err != nil || modFile.Module == nil {
+				return "", "", false
+			}
+			return modFile.Module.Mod.Path, dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
+
 // https://stackoverflow.com/questions/67211875/how-to-get-the-path-to-a-go-module-dependency
 func GetModulePath(name, version string) (string, error) {
 	// first we need GOMODCACHE
@@ -0,0 +1,529 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TestConfig selects the tests run by RunTests and tells how to report them.
+type TestConfig struct {
+	Run     string    // regular expression of the tests and examples to run, as with go test -run ; all if empty
+	Verbose bool      // report each test and stream its log, as with go test -v
+	Output  io.Writer // for the results and the print output of the tests ; os.Stdout if nil
+}
+
+// RunTests runs the tests and examples of a package, loaded by LoadTestPackage, one after the other in one VM.
+// The results are reported as by go test, ending with FAIL if a test failed or with PASS if verbose.
+// A test is a function TestXxx(t *testing.T) ; an example is a function ExampleXxx() with an output comment.
+// The output of an example is that of the print functions of fmt and the builtin print functions.
+// An error is returned if the tests could not run to their end, such as for a panic.
+func RunTests(pkg *Package, config TestConfig, options ...VMOption) (passed bool, err error) {
+	out := config.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	r := &testRun{config: config, out: out, helpers: map[Func]bool{}, stdout: &exampleOutput{out: out}}
+	if config.Run != "" {
+		// one expression for each level of subtests
+		for _, each := range strings.Split(config.Run, "/") {
+			re, err := regexp.Compile(each)
+			if err != nil {
+				return false, fmt.Errorf("invalid regexp for -run: %v", err)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+	}
+	r.root = &testingT{run: r}
+	r.vm = NewVM(pkg, append(options, func(vm *VM) {
+		vm.replacePrint(r.stdout)
+		vm.replaceStd("testing.Short", reflect.ValueOf(func() bool { return false }))
+		vm.replaceStd("testing.Testing", reflect.ValueOf(func() bool { return true }))
+		vm.replaceStd("testing.Verbose", reflect.ValueOf(func() bool { return config.Verbose }))
+	})...)
+	r.launch(testFuncs(pkg.Package.Syntax, pkg.Fset, pkg.TypesInfo))
+	if err := r.loop(); err != nil {
+		// the running tests have failed
+		for t := r.running; t != nil && t != r.root; t = t.parent {
+			t.failed = true
+			r.report(t)
+		}
+		return false, err
+	}
+	if r.ran == 0 {
+		fmt.Fprintln(out, "testing: warning: no tests to run")
+	}
+	if r.root.failed {
+		fmt.Fprintln(out, "FAIL")
+		return false, nil
+	}
+	if config.Verbose {
+		fmt.Fprintln(out, "PASS")
+	}
+	return true, nil
+}
+
+// testRun is the state of RunTests.
+type testRun struct {
+	vm       *VM
+	config   TestConfig
+	out      io.Writer
+	patterns []*regexp.Regexp // for each level of test names
+	root     *testingT        // parent of the tests and examples
+	running  *testingT        // innermost test that has started and not ended
+	stopped  *testingT        // test that called FailNow or SkipNow in the last step ; nil if none
+	helpers  map[Func]bool    // functions that called t.Helper
+	stdout   *exampleOutput
+	ran      int // number of tests and examples that have started
+}
+
+// testFunc is the name of a test or example function, in the order of declaration.
+type testFunc struct {
+	name    string
+	example *doc.Example // nil for a test
+}
+
+// testFuncs returns the test functions and the examples with an output comment of the test files of a package.
+// As with go test, the examples come after all tests.
+func testFuncs(files []*ast.File, fset *token.FileSet, info *types.Info) (funcs []testFunc) {
+	var testFiles []*ast.File
+	for _, each := range files {
+		if strings.HasSuffix(fset.Position(each.Pos()).Filename, "_test.go") {
+			testFiles = append(testFiles, each)
+		}
+	}
+	examples := map[string]*doc.Example{}
+	for _, each := range doc.Examples(testFiles...) {
+		if each.Output != "" || each.EmptyOutput {
+			examples["Example"+each.Name] = each
+		}
+	}
+	var exampleFuncs []testFunc
+	for _, file := range testFiles {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil {
+				continue
+			}
+			name := fd.Name.Name
+			if ex, ok := examples[name]; ok {
+				exampleFuncs = append(exampleFuncs, testFunc{name: name, example: ex})
+				continue
+			}
+			if isTestName(name) && isTestSignature(info, fd) {
+				funcs = append(funcs, testFunc{name: name})
+			}
+		}
+	}
+	return append(funcs, exampleFuncs...)
+}
+
+// isTestName returns whether a name is that of a test function, for which the rune after Test is not lower case.
+func isTestName(name string) bool {
+	if !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	if len(name) == len("Test") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return !unicode.IsLower(r)
+}
+
+// isTestSignature returns whether a function has the signature func(*testing.T).
+func isTestSignature(info *types.Info, fd *ast.FuncDecl) bool {
+	fn, ok := info.Defs[fd.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 1 && sig.Results().Len() == 0 && types.TypeString(sig.Params().At(0).Type(), nil) == "*testing.T"
+}
+
+// launch sets up the call flow that initializes the package and then starts each test and example.
+func (r *testRun) launch(funcs []testFunc) {
+	vm := r.vm
+	vm.pushNewFrame(nil)
+	// make sure PkgEnvironment is active ; not the frame's env.
+	vm.currentFrame.env = vm.pkg.env
+	gb := newGraphBuilder(vm.pkg.Package)
+	vm.pkg.addInitializationStep(gb, map[string]bool{})
+	for _, each := range funcs {
+		gb.nextStep(newFuncStep(token.NoPos, "run "+each.name, func(vm *VM) {
+			t := r.root.subtest(each.name)
+			t.example = each.example
+			if r.selected(t) {
+				r.start(t, vm.pkg.env.valueLookUp(each.name))
+			}
+		}))
+	}
+	vm.currentFrame.step = gb.head
+}
+
+// loop takes the steps of the tests until all have ended.
+// The frames of a test that called FailNow or SkipNow are removed after the step of the call.
+func (r *testRun) loop() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	for {
+		if err := r.vm.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if t := r.stopped; t != nil {
+			r.stopped = nil
+			r.unwind(t)
+		}
+	}
+}
+
+// selected returns whether the name of a test matches the -run expressions of its levels.
+func (r *testRun) selected(t *testingT) bool {
+	parts := strings.Split(t.name, "/")
+	for i, each := range r.patterns {
+		if i < len(parts) && !each.MatchString(parts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// start calls the function of a test in the current frame. The step of the frame continues with
+// a step that ends the test once the function has returned.
+func (r *testRun) start(t *testingT, fn reflect.Value) {
+	vm := r.vm
+	caller := vm.currentFrame
+	var end *funcStep
+	end = newFuncStep(caller.step.pos(), "end "+t.name, func(vm *VM) {
+		r.end(t, end)
+	})
+	end.SetNext(caller.step.Next())
+	if r.config.Verbose {
+		fmt.Fprintf(r.out, "=== RUN   %s\n", t.name)
+	}
+	r.ran++
+	r.running = t
+	t.started = time.Now()
+	var args []reflect.Value
+	if t.example == nil {
+		args = append(args, reflect.ValueOf(t))
+	} else {
+		r.stdout.captured = new(bytes.Buffer)
+	}
+	if r.call(fn, nil, end, args...) {
+		t.frame = vm.currentFrame
+		return
+	}
+	// not interpreted and has returned
+	caller.step = end
+}
+
+// end runs the cleanup functions of a test, each returning to the step that calls end, and then reports the test.
+// The result of a subtest, whether it has not failed, is pushed for its call of t.Run.
+func (r *testRun) end(t *testingT, step *funcStep) {
+	// the frame can be reused
+	t.frame = nil
+	for len(t.cleanups) > 0 {
+		last := t.cleanups[len(t.cleanups)-1]
+		t.cleanups = t.cleanups[:len(t.cleanups)-1]
+		if r.call(last.fn, last.env, step) {
+			return
+		}
+	}
+	if t.example != nil {
+		r.checkOutput(t)
+	}
+	r.report(t)
+	r.running = t.parent
+	if t.parent != r.root {
+		r.vm.pushOperand(reflect.ValueOf(!t.failed))
+	}
+}
+
+// call calls a function with arguments, as CallExpr does, and makes it return to a step.
+// For a function literal, env is where it was created if not the current environment.
+// It returns false if the function is not interpreted and has returned already.
+func (r *testRun) call(fn reflect.Value, env Env, returnTo Step, args ...reflect.Value) bool {
+	vm := r.vm
+	// the first argument is on top
+	for i := len(args) - 1; i >= 0; i-- {
+		vm.pushOperand(args[i])
+	}
+	vm.pushOperand(fn)
+	caller := vm.currentFrame
+	call := CallExpr{args: make([]Expr, len(args))}
+	for i := range args {
+		call.args[i] = noExpr{}
+	}
+	call.eval(vm)
+	if vm.currentFrame == caller {
+		return false
+	}
+	if _, ok := fn.Interface().(*FuncLit); ok && env != nil {
+		vm.currentFrame.env.(*Environment).parentEnv = env
+	}
+	vm.currentFrame.returnTo = returnTo
+	return true
+}
+
+// unwind removes the frames of a test that called FailNow or SkipNow ; the test ends with the next step.
+// As with runtime.Goexit, the deferred calls of each removed frame run before it is removed.
+func (r *testRun) unwind(t *testingT) {
+	vm := r.vm
+	if t.frame == nil || !slices.Contains(vm.callStack, t.frame) {
+		return
+	}
+	for {
+		top := vm.currentFrame
+		if len(top.defers) > 0 {
+			r.unwindDefers(t, top)
+			return
+		}
+		vm.popFrame()
+		if top == t.frame {
+			return
+		}
+	}
+}
+
+// unwindDefers makes a frame run its deferred calls, in reverse order, and then continue the unwinding of a test.
+// The deferred calls are taken from the frame such that a FailNow in one of them does not run them again.
+func (r *testRun) unwindDefers(t *testingT, frame *stackFrame) {
+	defers := frame.defers
+	frame.defers = nil
+	b := newGraphBuilder(r.vm.pkg.Package)
+	block := BlockStmt{}
+	for i := len(defers) - 1; i >= 0; i-- {
+		invocation := defers[i]
+		push := &pushArgumentsStmt{args: invocation.arguments, env: invocation.env}
+		stmt := ExprStmt{x: DeferCallExpr{CallExpr: invocation.call.(CallExpr)}}
+		block.list = append(block.list, push, stmt)
+	}
+	head := block.flow(b)
+	b.nextStep(newFuncStep(token.NoPos, "~unwind "+t.name, func(vm *VM) {
+		r.unwind(t)
+	}))
+	frame.step = head
+}
+
+// checkOutput compares the print output of an example with its output comment.
+func (r *testRun) checkOutput(t *testingT) {
+	got := strings.TrimSpace(r.stdout.captured.String())
+	r.stdout.captured = nil
+	want := strings.TrimSpace(t.example.Output)
+	if t.example.Unordered {
+		got, want = sortLines(got), sortLines(want)
+	}
+	if got == want {
+		return
+	}
+	t.failed = true
+	if t.example.Unordered {
+		fmt.Fprintf(&t.output, "got:\n%s\nwant (unordered):\n%s\n", got, want)
+		return
+	}
+	fmt.Fprintf(&t.output, "got:\n%s\nwant:\n%s\n", got, want)
+}
+
+func sortLines(s string) string {
+	lines := strings.Split(s, "\n")
+	slices.Sort(lines)
+	return strings.Join(lines, "\n")
+}
+
+// report writes the result of a test, followed by its output, as go test does. Only failures are reported
+// unless verbose. The report of a subtest is part of the output of its parent, indented.
+func (r *testRun) report(t *testingT) {
+	if t.failed {
+		t.parent.failed = true
+	}
+	if !t.failed && !r.config.Verbose {
+		return
+	}
+	result := "PASS"
+	if t.failed {
+		result = "FAIL"
+	} else if t.skipped {
+		result = "SKIP"
+	}
+	text := fmt.Sprintf("--- %s: %s (%.2fs)\n%s", result, t.name, time.Since(t.started).Seconds(), t.output.String())
+	if t.parent == r.root {
+		io.WriteString(r.out, text)
+		return
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line != "" {
+			t.parent.output.WriteString("    " + line)
+		}
+	}
+}
+
+// caller returns the position of the call of a method of testingT, outside functions that called t.Helper.
+func (r *testRun) caller() token.Position {
+	vm := r.vm
+	for i := len(vm.callStack) - 1; i >= 0; i-- {
+		frame := vm.callStack[i]
+		if i > 0 && r.helpers[frame.callee] {
+			continue
+		}
+		return vm.positionOf(frame, frame.step)
+	}
+	return token.Position{}
+}
+
+// exampleOutput is where the program prints ; the output is captured while an example runs.
+type exampleOutput struct {
+	out      io.Writer
+	captured *bytes.Buffer // nil if no example runs
+}
+
+func (o *exampleOutput) Write(p []byte) (int, error) {
+	if o.captured != nil {
+		return o.captured.Write(p)
+	}
+	return o.out.Write(p)
+}
+
+// subtestRun is the value of the method t.Run of a testingT. Its call is handled by CallExpr
+// because the function of the subtest is interpreted.
+type subtestRun struct {
+	t *testingT
+}
+
+// cleanup is a function passed to t.Cleanup, with the environment in which it was passed.
+type cleanup struct {
+	fn  reflect.Value
+	env Env
+}
+
+// testingT is the value of the *testing.T parameter of interpreted tests. Its methods are those of testing.T
+// that tests commonly call ; Run is handled by CallExpr, see subtestRun. Parallel tests run one after the other.
+type testingT struct {
+	run      *testRun
+	parent   *testingT
+	name     string
+	failed   bool
+	skipped  bool
+	output   bytes.Buffer   // log and reports of subtests
+	cleanups []cleanup      // in the order of t.Cleanup
+	frame    *stackFrame    // of the test function while it runs
+	started  time.Time      // when the test function was called
+	names    map[string]int // number of subtests by name
+	example  *doc.Example   // nil for a test
+}
+
+// subtest returns a test with a unique name below t.
+func (t *testingT) subtest(name string) *testingT {
+	name = strings.ReplaceAll(name, " ", "_")
+	if t.names == nil {
+		t.names = map[string]int{}
+	}
+	if n := t.names[name]; n > 0 {
+		t.names[name] = n + 1
+		name = fmt.Sprintf("%s#%02d", name, n)
+	} else {
+		t.names[name] = 1
+	}
+	if t.parent != nil {
+		name = t.name + "/" + name
+	}
+	return &testingT{run: t.run, parent: t, name: name}
+}
+
+func (t *testingT) Name() string  { return t.name }
+func (t *testingT) Failed() bool  { return t.failed }
+func (t *testingT) Skipped() bool { return t.skipped }
+func (t *testingT) Fail()         { t.failed = true }
+func (t *testingT) Parallel()     {}
+
+// FailNow marks the test failed and stops it after the current step.
+func (t *testingT) FailNow() {
+	t.failed = true
+	t.run.stopped = t
+}
+
+// SkipNow marks the test skipped and stops it after the current step.
+func (t *testingT) SkipNow() {
+	t.skipped = true
+	t.run.stopped = t
+}
+
+func (t *testingT) Log(args ...any)                 { t.log(fmt.Sprintln(args...)) }
+func (t *testingT) Logf(format string, args ...any) { t.log(fmt.Sprintf(format, args...)) }
+
+func (t *testingT) Error(args ...any) {
+	t.log(fmt.Sprintln(args...))
+	t.Fail()
+}
+
+func (t *testingT) Errorf(format string, args ...any) {
+	t.log(fmt.Sprintf(format, args...))
+	t.Fail()
+}
+
+func (t *testingT) Fatal(args ...any) {
+	t.log(fmt.Sprintln(args...))
+	t.FailNow()
+}
+
+func (t *testingT) Fatalf(format string, args ...any) {
+	t.log(fmt.Sprintf(format, args...))
+	t.FailNow()
+}
+
+func (t *testingT) Skip(args ...any) {
+	t.log(fmt.Sprintln(args...))
+	t.SkipNow()
+}
+
+func (t *testingT) Skipf(format string, args ...any) {
+	t.log(fmt.Sprintf(format, args...))
+	t.SkipNow()
+}
+
+// Helper marks the calling function as a test helper ; positions in the log are those of its callers.
+func (t *testingT) Helper() {
+	if frame := t.run.vm.currentFrame; frame != nil && frame.callee != nil {
+		t.run.helpers[frame.callee] = true
+	}
+}
+
+// Cleanup registers a function to call when the test and its subtests have ended, the last registered first.
+func (t *testingT) Cleanup(f any) {
+	env := t.run.vm.currentEnv()
+	// the function can refer to variables of the environment after it is popped
+	env.markShared()
+	t.cleanups = append(t.cleanups, cleanup{fn: reflect.ValueOf(f), env: env})
+}
+
+// log writes a message with the position of the caller, streamed if verbose, as go test does.
+func (t *testingT) log(s string) {
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.ReplaceAll(s, "\n", "\n        ")
+	if p := t.run.caller(); p.IsValid() {
+		s = fmt.Sprintf("%s:%d: %s", filepath.Base(p.Filename), p.Line, s)
+	}
+	if t.run.config.Verbose {
+		fmt.Fprintf(t.run.out, "    %s\n", s)
+		return
+	}
+	fmt.Fprintf(&t.output, "    %s\n", s)
+}
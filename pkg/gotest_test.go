@@ -0,0 +1,248 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const calcSource = `package calc
+
+func Add(a, b int) int { return a + b }
+`
+
+// runTestSource runs the tests of a package with a test file and returns the report and whether they passed.
+func runTestSource(t *testing.T, testSource string, config TestConfig) (string, bool) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":       "module calc\n\ngo 1.24\n",
+		"calc.go":      calcSource,
+		"calc_test.go": testSource,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gopkg, err := LoadTestPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := BuildPackage(gopkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(strings.Builder)
+	config.Output = out
+	passed, err := RunTests(pkg, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// durations vary
+	return durations.ReplaceAllString(out.String(), "(0.00s)"), passed
+}
+
+var durations = regexp.MustCompile(`\(\d+\.\d+s\)`)
+
+const subtestsSource = `package calc
+
+import "testing"
+
+func check(t *testing.T, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	for _, each := range []string{"one", "two"} {
+		ok := t.Run(each, func(t *testing.T) {
+			if each == "two" {
+				check(t, Add(1, 0), 2)
+			}
+		})
+		t.Log(each, ok)
+	}
+}
+
+func TestFatal(t *testing.T) {
+	t.Fatal("stop")
+	t.Log("not reached")
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip("later")
+}
+`
+
+func TestRunTestsReportsFailures(t *testing.T) {
+	out, passed := runTestSource(t, subtestsSource, TestConfig{})
+	if passed {
+		t.Error("expected failure")
+	}
+	want := `--- FAIL: TestAdd (0.00s)
+    calc_test.go:19: one true
+    --- FAIL: TestAdd/two (0.00s)
+        calc_test.go:16: got 1 want 2
+    calc_test.go:19: two false
+--- FAIL: TestFatal (0.00s)
+    calc_test.go:24: stop
+FAIL
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRunTestsVerbose(t *testing.T) {
+	out, _ := runTestSource(t, subtestsSource, TestConfig{Verbose: true, Run: "Add|Skip/one"})
+	want := `=== RUN   TestAdd
+=== RUN   TestAdd/one
+    calc_test.go:19: one true
+    calc_test.go:19: two true
+--- PASS: TestAdd (0.00s)
+    --- PASS: TestAdd/one (0.00s)
+=== RUN   TestSkip
+    calc_test.go:29: later
+--- SKIP: TestSkip (0.00s)
+PASS
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRunTestsCleanup(t *testing.T) {
+	out, passed := runTestSource(t, `package calc
+
+import "testing"
+
+var cleaned []string
+
+func TestCleanup(t *testing.T) {
+	name := "outer"
+	t.Cleanup(func() { cleaned = append(cleaned, name) })
+	t.Run("inner", func(t *testing.T) {
+		t.Cleanup(func() { cleaned = append(cleaned, "inner") })
+	})
+}
+
+func TestCleaned(t *testing.T) {
+	t.Log(cleaned)
+}
+`, TestConfig{Verbose: true})
+	if !passed {
+		t.Fatal(out)
+	}
+	if !strings.Contains(out, "calc_test.go:16: [inner outer]") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRunTestsExamples(t *testing.T) {
+	out, passed := runTestSource(t, `package calc
+
+import "fmt"
+
+func ExampleAdd() {
+	fmt.Println(Add(1, 2))
+	// Output: 3
+}
+
+func ExampleAdd_wrong() {
+	fmt.Println(Add(1, 1))
+	// Output: 3
+}
+
+func ExampleAdd_noOutput() {
+	fmt.Println(Add(1, 1))
+}
+`, TestConfig{Verbose: true})
+	if passed {
+		t.Error("expected failure")
+	}
+	want := `=== RUN   ExampleAdd
+--- PASS: ExampleAdd (0.00s)
+=== RUN   ExampleAdd_wrong
+--- FAIL: ExampleAdd_wrong (0.00s)
+got:
+2
+want:
+3
+FAIL
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRunTestsWithoutMatch(t *testing.T) {
+	out, passed := runTestSource(t, subtestsSource, TestConfig{Run: "Missing"})
+	if !passed {
+		t.Error("expected pass")
+	}
+	if got, want := out, "testing: warning: no tests to run\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestRunTestsFatalRunsDefers(t *testing.T) {
+	out, passed := runTestSource(t, `package calc
+
+import "testing"
+
+func check(t *testing.T) {
+	defer t.Log("check deferred")
+	t.Fatal("stop")
+}
+
+func TestFatal(t *testing.T) {
+	defer t.Log("test deferred")
+	check(t)
+	t.Log("not reached")
+}
+`, TestConfig{})
+	if passed {
+		t.Error("expected failure")
+	}
+	for _, each := range []string{"stop", "check deferred", "test deferred"} {
+		if !strings.Contains(out, each) {
+			t.Errorf("missing %q in:\n%s", each, out)
+		}
+	}
+	if strings.Contains(out, "not reached") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if strings.Index(out, "check deferred") > strings.Index(out, "test deferred") {
+		t.Errorf("deferred calls out of order:\n%s", out)
+	}
+}
+
+func TestRunTestsExamplesAfterTests(t *testing.T) {
+	out, _ := runTestSource(t, `package calc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ExampleAdd() {
+	fmt.Println(Add(1, 2))
+	// Output: 3
+}
+
+func TestAdd(t *testing.T) {}
+`, TestConfig{Verbose: true})
+	want := `=== RUN   TestAdd
+--- PASS: TestAdd (0.00s)
+=== RUN   ExampleAdd
+--- PASS: ExampleAdd (0.00s)
+PASS
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
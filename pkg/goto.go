@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"slices"
+)
+
+// gotoTarget is a statement in the function of a frame to which the execution of the frame can jump.
+type gotoTarget struct {
+	frame    *stackFrame
+	from     Step // next step of the frame when the target was found
+	step     Step
+	pops     int // environments of blocks to leave
+	position token.Position
+}
+
+// flowStep is a step in the call graph of a function.
+type flowStep struct {
+	step Step
+	// push steps of the blocks that are entered before taking the step
+	blocks []*pushEnvironmentStep
+	// whether the step is the first of its line, i.e. taken after a step on another line
+	entered bool
+}
+
+// gotoTargets returns the statements that begin on a line in the function of the current frame and to which its
+// execution can jump: in the block of the next step or in an enclosing block. Jumping into a block is not possible
+// because its variables would not be declared.
+func (vm *VM) gotoTargets(file string, line int) (targets []gotoTarget) {
+	frame := vm.currentFrame
+	if frame == nil || frame.step == nil {
+		return nil
+	}
+	var head Step
+	switch f := frame.callee.(type) {
+	case *FuncDecl:
+		head = f.callGraph
+	case *FuncLit:
+		head = f.callGraph
+	}
+	flow := vm.flowOf(frame, head)
+	at := slices.IndexFunc(flow, func(each *flowStep) bool { return each.step == frame.step })
+	if at == -1 {
+		return nil
+	}
+	current := flow[at]
+	if _, ok := vm.statementStarts(file)[line]; !ok {
+		return nil
+	}
+	for _, each := range flow {
+		if !each.entered || len(each.blocks) > len(current.blocks) || !slices.Equal(each.blocks, current.blocks[:len(each.blocks)]) {
+			continue
+		}
+		p := vm.positionOf(frame, each.step)
+		if p.Filename != file || p.Line != line {
+			continue
+		}
+		targets = append(targets, gotoTarget{
+			frame:    frame,
+			from:     frame.step,
+			step:     each.step,
+			pops:     len(current.blocks) - len(each.blocks),
+			position: p,
+		})
+	}
+	return
+}
+
+// gotoStep moves the execution of the frame of a target to its step. Operands are cleared.
+func (vm *VM) gotoStep(target gotoTarget) error {
+	frame := target.frame
+	if frame != vm.currentFrame || frame.step != target.from {
+		return errors.New("the program has moved since the goto targets were requested")
+	}
+	if vm.journal != nil {
+		// jumping can be undone by stepping back
+		vm.journal.begin(vm)
+		defer func() { vm.journal.current = nil }()
+	}
+	for range target.pops {
+		frame.popEnv()
+	}
+	frame.operands = frame.operands[:0]
+	frame.step = target.step
+	return nil
+}
+
+// flowOf returns the steps of the call graph of a function in breadth-first order.
+// Detached flows, such as of defer and go statements and function literals, are not part of it.
+func (vm *VM) flowOf(frame *stackFrame, head Step) (flow []*flowStep) {
+	seen := map[Step]*flowStep{}
+	add := func(s Step, blocks []*pushEnvironmentStep, fromLine int) {
+		if s == nil {
+			return
+		}
+		entered := vm.positionOf(frame, s).Line != fromLine
+		if f, ok := seen[s]; ok {
+			f.entered = f.entered || entered
+			return
+		}
+		f := &flowStep{step: s, blocks: blocks, entered: entered}
+		seen[s] = f
+		flow = append(flow, f)
+	}
+	add(head, nil, 0)
+	for i := 0; i < len(flow); i++ {
+		f := flow[i]
+		blocks := f.blocks
+		switch s := f.step.(type) {
+		case *pushEnvironmentStep:
+			blocks = append(slices.Clip(blocks), s)
+		case *popEnvironmentStep:
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+		from := vm.positionOf(frame, f.step).Line
+		for _, each := range successorsOf(f.step) {
+			add(each, blocks, from)
+		}
+	}
+	return
+}
+
+// successorsOf returns the steps that can be taken after a step in the same frame.
+func successorsOf(s Step) []Step {
+	next := []Step{s.Next()}
+	switch b := s.(type) {
+	case *conditionalStep:
+		next = append(next, b.conditionFlow, b.elseFlow)
+	case *rangeMapIteratorNextStep:
+		next = append(next, b.bodyFlow)
+	case *rangeIteratorSwitchStep:
+		next = append(next, b.mapFlow, b.sliceOrArrayFlow, b.intFlow, b.chanFlow)
+	}
+	return next
+}
+
+// statementStarts returns the position of the first statement that begins on a line of a source file, by line.
+// Blocks and clauses of switch and select statements are not statements to jump to.
+func (vm *VM) statementStarts(file string) map[int]token.Position {
+	starts := map[int]token.Position{}
+	for _, pkg := range vm.packages() {
+		for _, syntax := range pkg.Syntax {
+			if pkg.Fset.Position(syntax.Pos()).Filename != file {
+				continue
+			}
+			ast.Inspect(syntax, func(n ast.Node) bool {
+				switch n.(type) {
+				case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+				case ast.Stmt:
+					p := pkg.Fset.Position(n.Pos())
+					if first, ok := starts[p.Line]; !ok || p.Column < first.Column {
+						starts[p.Line] = p
+					}
+				}
+				return true
+			})
+		}
+	}
+	return starts
+}
@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"io"
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+const failSource = `package main
+
+func fail() {
+	panic("boom")
+}
+func main() {
+	x := 1
+	fail()
+	x = 2
+	print(x)
+}`
+
+func TestGotoSkipsFailingCall(t *testing.T) {
+	xs := continueToBreakpointIn(t, failSource, 8)
+	file := xs.vm.pkg.GoFiles[0]
+	targets := xs.GotoTargets(file, 9)
+	if got, want := len(targets), 1; got != want {
+		t.Fatalf("got %d want %d", got, want)
+	}
+	if got, want := targets[0].Line, 9; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if err := xs.Goto(targets[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(xs.vm.currentFrame.operands), 0; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	bp, _ := NewBreakpoint(file, dap.SourceBreakpoint{Line: 10})
+	xs.SetBreakpoints(file, []*Breakpoint{bp})
+	if reason, err := xs.Continue(func() bool { return false }); err != nil || reason != "breakpoint" {
+		t.Fatalf("got %q %v want breakpoint", reason, err)
+	}
+	if got, want := evalString(t, xs, "x"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.Continue(func() bool { return false }); err != io.EOF {
+		t.Fatalf("got %v want EOF", err)
+	}
+}
+
+func TestGotoRerunsLoopIteration(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{Condition: "i == 9"})
+	file := xs.vm.pkg.GoFiles[0]
+	// the for statement can be entered at its init statement and at the end of an iteration
+	targets := xs.GotoTargets(file, 8)
+	if got, want := len(targets), 2; got != want {
+		t.Fatalf("got %d want %d", got, want)
+	}
+	// restart the loop
+	if err := xs.Goto(targets[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	bp, _ := NewBreakpoint(file, dap.SourceBreakpoint{Line: 11})
+	xs.SetBreakpoints(file, []*Breakpoint{bp})
+	if reason, err := xs.Continue(func() bool { return false }); err != nil || reason != "breakpoint" {
+		t.Fatalf("got %q %v want breakpoint", reason, err)
+	}
+	// the squares of 0..9 are added again
+	if got, want := evalString(t, xs, "sum"), "489"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestGotoTargetsNotIntoBlock(t *testing.T) {
+	pkg := buildPackage(t, loopSource)
+	xs := NewDAPAccess(NewVM(pkg))
+	bp, _ := NewBreakpoint(pkg.GoFiles[0], dap.SourceBreakpoint{Line: 7})
+	xs.SetBreakpoints(pkg.GoFiles[0], []*Breakpoint{bp})
+	xs.Launch("main", nil)
+	if reason, err := xs.Continue(func() bool { return false }); err != nil || reason != "breakpoint" {
+		t.Fatalf("got %q %v want breakpoint", reason, err)
+	}
+	if got := xs.GotoTargets(pkg.GoFiles[0], 9); len(got) != 0 {
+		t.Errorf("got %v want no targets", got)
+	}
+	if got := xs.GotoTargets(pkg.GoFiles[0], 11); len(got) != 1 {
+		t.Errorf("got %v want one target", got)
+	}
+	if err := xs.Goto(3); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
@@ -9,6 +9,9 @@ import (
 type Heap struct {
 	values  map[uintptr]reflect.Value // heap storage for escaped pointers
 	counter uintptr                   // counter for generating unique heap addresses
+	race    *raceDetector             // non-nil if data races are detected
+	watch   *watcher                  // non-nil if data breakpoints are set
+	journal *journal                  // non-nil if writes are recorded for stepping back
 }
 
 func newHeap() *Heap {
@@ -100,6 +103,9 @@ func (h *Heap) allocHeapVar(env Env, varName string, varType reflect.Type) *Heap
 
 // read retrieves a value from the VM heap.
 func (h *Heap) read(hp *HeapPointer) reflect.Value {
+	if h.race != nil {
+		h.race.access(h.raceKey(hp), false)
+	}
 	// If this is an environment reference, read from the environment
 	if hp.env != nil {
 		val := hp.env.valueLookUp(hp.envVarName)
@@ -116,14 +122,38 @@ func (h *Heap) read(hp *HeapPointer) reflect.Value {
 
 // write updates a value in the VM heap.
 func (h *Heap) write(hp *HeapPointer, value reflect.Value) {
+	if h.race != nil {
+		h.race.access(h.raceKey(hp), true)
+	}
+	if h.watch != nil {
+		var old reflect.Value
+		if hp.env != nil {
+			old = hp.env.valueLookUp(hp.envVarName)
+		} else {
+			old = h.values[hp.addr]
+		}
+		h.watch.write(h.raceKey(hp), old, value)
+	}
 	// If this is an environment reference, write to the environment
 	if hp.env != nil {
 		hp.env.valueSet(hp.envVarName, value)
 		return
 	}
 	// Otherwise, write to heap storage
-	if _, ok := h.values[hp.addr]; !ok {
+	old, ok := h.values[hp.addr]
+	if !ok {
 		panic("invalid heap address")
 	}
+	if h.journal != nil {
+		h.journal.record(h.raceKey(hp), func() { h.values[hp.addr] = old })
+	}
 	h.values[hp.addr] = value
 }
+
+// raceKey returns the memory location a heap pointer refers to.
+func (h *Heap) raceKey(hp *HeapPointer) raceKey {
+	if hp.env != nil {
+		return raceKey{owner: hp.env, name: hp.envVarName}
+	}
+	return raceKey{owner: h, addr: hp.addr}
+}
@@ -12,10 +12,19 @@ var _ CanAssign = Ident{}
 type Ident struct {
 	name    string
 	namePos token.Pos
+	// set if the name is that of a builtin function, e.g. print, that a VM can replace ; the name can be redeclared
+	builtinName bool
 }
 
 func (i Ident) eval(vm *VM) {
-	vm.pushOperand(vm.currentEnv().valueLookUp(i.name))
+	if vm.race != nil {
+		vm.race.readVar(vm.currentEnv(), i.name)
+	}
+	v := vm.currentEnv().valueLookUp(i.name)
+	if i.builtinName {
+		v = vm.lookUpStd(i.name, v)
+	}
+	vm.pushOperand(v)
 }
 
 func (i Ident) assign(vm *VM, value reflect.Value) {
@@ -33,9 +42,16 @@ func (i Ident) assign(vm *VM, value reflect.Value) {
 		vm.heap.write(hp, value)
 		return
 	}
+	if vm.race != nil {
+		vm.race.writeVar(owner, i.name)
+	}
+	vm.watchVar(owner, i.name, oldValue, value)
 	owner.valueSet(i.name, value)
 }
 func (i Ident) define(vm *VM, value reflect.Value) {
+	if vm.race != nil {
+		vm.race.defineVar(vm.currentEnv(), i.name)
+	}
 	vm.currentEnv().valueSet(i.name, value)
 }
 
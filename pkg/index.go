@@ -52,8 +52,10 @@ func (i IndexExpr) assign(vm *VM, value reflect.Value) {
 	}
 	switch target.Kind() {
 	case reflect.Map:
+		vm.recordMapIndex(target, index)
 		target.SetMapIndex(index, value)
 	case reflect.Slice, reflect.Array:
+		vm.recordSettable(target.Index(int(index.Int())))
 		target.Index(int(index.Int())).Set(value)
 	default:
 		vm.fatalf("expected map or slice or array")
@@ -0,0 +1,11 @@
+package main
+
+// a depends on b which is declared in other.go
+var a = b + 1
+
+func main() {
+	if a != 3 || b != 2 {
+		panic("package variables not initialized in dependency order")
+	}
+	print(a, b)
+}
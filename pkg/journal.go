@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+)
+
+// WithRecording makes the VM journal each step so that a debugger can step backwards.
+// For each step, the journal holds the state of the call stacks and routines and the values overwritten in
+// environments, the heap, struct fields, slices and maps. At most maxSteps steps are kept ; zero means no limit.
+// Effects outside the VM, such as output, channel operations and changes made by SDK functions, are not undone.
+func WithRecording(maxSteps int) VMOption {
+	return func(vm *VM) {
+		vm.journal = &journal{limit: maxSteps}
+		vm.keepCallArgs = true
+		vm.heap.journal = vm.journal
+		// package variables are written through the package environments
+		vm.pkg.env.Env.(*Environment).journal = vm.journal
+		for _, each := range vm.pkg.env.packages {
+			if env, ok := each.env.Env.(*Environment); ok {
+				env.journal = vm.journal
+			}
+		}
+	}
+}
+
+// errNoHistory is returned when stepping back and there is no recorded step left.
+var errNoHistory = errors.New("no recorded step to go back to")
+
+// journal records how to restore the VM to the state before each step.
+// While recording, frames and environments are not recycled because restored states refer to them.
+type journal struct {
+	limit   int
+	entries []*journalEntry
+	current *journalEntry // entry of the step being taken ; nil between steps
+}
+
+// journalEntry holds the state of the VM before a step and how to undo the writes of that step.
+type journalEntry struct {
+	routine      *routine
+	routines     []*routine
+	routineState []routine // by index of routines
+	callStack    stack[*stackFrame]
+	currentFrame *stackFrame
+	frames       []*stackFrame
+	frameState   []stackFrame // by index of frames
+	frameIdSeq   int
+	routineIdSeq int
+	pendingPanic *PanicStop
+	undos        []func()  // in order of writing
+	written      []raceKey // memory locations written, for data breakpoints
+}
+
+// begin records the state of the VM before it takes a step.
+func (j *journal) begin(vm *VM) {
+	e := &journalEntry{
+		routine:      vm.routine,
+		routines:     slices.Clone(vm.routines),
+		callStack:    slices.Clone(vm.callStack),
+		currentFrame: vm.currentFrame,
+		frameIdSeq:   vm.frameIdSeq,
+		routineIdSeq: vm.routineIdSeq,
+		pendingPanic: vm.pendingPanic,
+	}
+	seen := map[*stackFrame]bool{}
+	saveFrames := func(s stack[*stackFrame]) {
+		for _, each := range s {
+			if seen[each] {
+				continue
+			}
+			seen[each] = true
+			state := *each
+			state.operands = slices.Clone(each.operands)
+			state.defers = slices.Clone(each.defers)
+			e.frames = append(e.frames, each)
+			e.frameState = append(e.frameState, state)
+		}
+	}
+	saveFrames(vm.callStack)
+	for _, each := range vm.routines {
+		state := *each
+		state.callStack = slices.Clone(each.callStack)
+		e.routineState = append(e.routineState, state)
+		saveFrames(each.callStack)
+	}
+	j.current = e
+	j.entries = append(j.entries, e)
+	if j.limit > 0 && len(j.entries) > j.limit {
+		j.entries[0] = nil
+		j.entries = j.entries[1:]
+	}
+}
+
+// cancel forgets the entry of a step that was not taken.
+func (j *journal) cancel() {
+	if j.current != nil {
+		j.entries = j.entries[:len(j.entries)-1]
+		j.current = nil
+	}
+}
+
+// record adds how to undo a write to the step being taken.
+func (j *journal) record(key raceKey, undo func()) {
+	if j.current == nil {
+		// not part of a step, e.g. an evaluation by the debugger
+		return
+	}
+	j.current.undos = append(j.current.undos, undo)
+	if key.owner != nil {
+		j.current.written = append(j.current.written, key)
+	}
+}
+
+// recordSet records the write of a variable in an environment.
+func (j *journal) recordSet(env *Environment, name string) {
+	old, existed := env.values[name]
+	j.record(raceKey{owner: env, name: name}, func() {
+		if existed {
+			env.values[name] = old
+		} else {
+			delete(env.values, name)
+		}
+	})
+}
+
+// recordField records the write of a field of an interpreted struct value.
+func (vm *VM) recordField(recv reflect.Value, name string) {
+	if vm.journal == nil {
+		return
+	}
+	if sv, ok := recv.Interface().(StructValue); ok {
+		fields := sv.fields
+		old := (*fields)[name]
+		vm.journal.record(raceKey{owner: fields, name: name}, func() { (*fields)[name] = old })
+	}
+}
+
+// recordSettable records the write of a settable value, e.g. an element of a slice.
+func (vm *VM) recordSettable(v reflect.Value) {
+	if vm.journal == nil {
+		return
+	}
+	old := reflect.New(v.Type()).Elem()
+	old.Set(v)
+	vm.journal.record(raceKey{}, func() { v.Set(old) })
+}
+
+// recordMapIndex records the write of a map entry.
+func (vm *VM) recordMapIndex(m, key reflect.Value) {
+	if vm.journal == nil {
+		return
+	}
+	old := m.MapIndex(key)
+	vm.journal.record(raceKey{}, func() { m.SetMapIndex(key, old) })
+}
+
+// StepBack restores the VM to the state before the last step, if the VM was created WithRecording.
+func (vm *VM) StepBack() error {
+	if vm.journal == nil {
+		return errors.New("steps are not recorded")
+	}
+	e := vm.journal.pop()
+	if e == nil {
+		return errNoHistory
+	}
+	for i := len(e.undos) - 1; i >= 0; i-- {
+		e.undos[i]()
+	}
+	for i, each := range e.frames {
+		*each = e.frameState[i]
+	}
+	for i, each := range e.routines {
+		*each = e.routineState[i]
+	}
+	vm.routine = e.routine
+	vm.routines = e.routines
+	vm.callStack = e.callStack
+	vm.currentFrame = e.currentFrame
+	vm.frameIdSeq = e.frameIdSeq
+	vm.routineIdSeq = e.routineIdSeq
+	vm.pendingPanic = e.pendingPanic
+	return nil
+}
+
+// pop removes and returns the entry of the last step ; nil if there is none.
+func (j *journal) pop() *journalEntry {
+	if len(j.entries) == 0 {
+		return nil
+	}
+	e := j.entries[len(j.entries)-1]
+	j.entries = j.entries[:len(j.entries)-1]
+	return e
+}
+
+// top returns the entry of the last step ; nil if there is none.
+func (j *journal) top() *journalEntry {
+	if len(j.entries) == 0 {
+		return nil
+	}
+	return j.entries[len(j.entries)-1]
+}
+
+// frameStateOf returns the recorded state of a frame ; false if the frame did not exist before the step.
+func (e *journalEntry) frameStateOf(frame *stackFrame) (stackFrame, bool) {
+	for i, each := range e.frames {
+		if each == frame {
+			return e.frameState[i], true
+		}
+	}
+	return stackFrame{}, false
+}
+
+// valueAt returns the value of a memory location that can be written by a step ; invalid if there is none.
+func (vm *VM) valueAt(key raceKey) reflect.Value {
+	switch owner := key.owner.(type) {
+	case *Environment:
+		return owner.values[key.name]
+	case *map[string]reflect.Value:
+		return (*owner)[key.name]
+	case *Heap:
+		return owner.values[key.addr]
+	}
+	return reflect.Value{}
+}
+
+// journalOf returns the journal of an environment ; nil if its VM does not record steps.
+func journalOf(env Env) *journal {
+	switch e := env.(type) {
+	case *Environment:
+		return e.journal
+	case *PkgEnvironment:
+		return journalOf(e.Env)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"io"
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+// recordTo launches main of a recording VM and continues until the breakpoint is hit.
+func recordTo(t *testing.T, source string, sb dap.SourceBreakpoint) *DAPAccess {
+	t.Helper()
+	pkg := buildPackage(t, source)
+	xs := NewDAPAccess(NewVM(pkg, WithRecording(0)))
+	bp, err := NewBreakpoint(pkg.GoFiles[0], sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs.SetBreakpoints(pkg.GoFiles[0], []*Breakpoint{bp})
+	xs.Launch("main", nil)
+	reason, err := xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	return xs
+}
+
+func TestStepBackRestoresState(t *testing.T) {
+	xs := recordTo(t, loopSource, dap.SourceBreakpoint{Line: 9, Condition: "i == 6"})
+	frame := xs.vm.currentFrame
+	for range 50 {
+		if err := xs.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := evalString(t, xs, "i"), "6"; got == want {
+		t.Fatalf("got %q want another value", got)
+	}
+	for range 50 {
+		if err := xs.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if xs.vm.currentFrame != frame {
+		t.Error("expected frame of the breakpoint")
+	}
+	if got, want := evalString(t, xs, "i"), "6"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "sum"), "55"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// running forward again gives the same result
+	if _, err := xs.Continue(func() bool { return false }); err != io.EOF {
+		t.Fatalf("got %v want EOF", err)
+	}
+}
+
+func TestStepBackWithoutHistory(t *testing.T) {
+	xs := NewDAPAccess(NewVM(buildPackage(t, loopSource)))
+	xs.Launch("main", nil)
+	if xs.CanStepBack() {
+		t.Error("expected no recording")
+	}
+	if err := xs.StepBack(); err == nil {
+		t.Error("expected error")
+	}
+	xs = NewDAPAccess(NewVM(buildPackage(t, loopSource), WithRecording(0)))
+	xs.Launch("main", nil)
+	if err := xs.StepBack(); err != errNoHistory {
+		t.Errorf("got %v want %v", err, errNoHistory)
+	}
+}
+
+func TestStepBackRecordingLimit(t *testing.T) {
+	xs := NewDAPAccess(NewVM(buildPackage(t, loopSource), WithRecording(10)))
+	xs.Launch("main", nil)
+	for range 20 {
+		if err := xs.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 10 {
+		if err := xs.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := xs.StepBack(); err != errNoHistory {
+		t.Errorf("got %v want %v", err, errNoHistory)
+	}
+}
+
+const collectionsSource = `package main
+
+type Point struct {
+	x, y int
+}
+
+func main() {
+	p := Point{1, 2}
+	s := []int{1, 2, 3}
+	m := map[string]int{"a": 1}
+	h := &Point{3, 4}
+	p.x = 10
+	s[1] = 20
+	m["a"] = 30
+	m["b"] = 40
+	h.y = 50
+	print(p.x, s[1], m["a"], h.y)
+}`
+
+func TestStepBackUndoesWrites(t *testing.T) {
+	xs := recordTo(t, collectionsSource, dap.SourceBreakpoint{Line: 12})
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], nil)
+	before := map[string]string{}
+	exprs := []string{"p.x", "s[1]", "m[\"a\"]", "len(m)", "h.y"}
+	for _, each := range exprs {
+		before[each] = evalString(t, xs, each)
+	}
+	steps := 0
+	for xs.vm.positionOf(xs.vm.currentFrame, xs.vm.currentFrame.step).Line < 17 {
+		if err := xs.Next(); err != nil {
+			t.Fatal(err)
+		}
+		steps++
+	}
+	if got, want := evalString(t, xs, "len(m)"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	for range steps {
+		if err := xs.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, each := range exprs {
+		if got, want := evalString(t, xs, each), before[each]; got != want {
+			t.Errorf("%s: got %q want %q", each, got, want)
+		}
+	}
+}
+
+func TestReverseContinueToBreakpoint(t *testing.T) {
+	xs := recordTo(t, loopSource, dap.SourceBreakpoint{Line: 9, Condition: "i == 6"})
+	bp, _ := NewBreakpoint(xs.vm.pkg.GoFiles[0], dap.SourceBreakpoint{Line: 9})
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], []*Breakpoint{bp})
+	reason, err := xs.ReverseContinue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "i"), "5"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// forward again to the next hit
+	reason, err = xs.Continue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := evalString(t, xs, "i"), "6"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], nil)
+	if reason, _ := xs.ReverseContinue(func() bool { return false }); reason != "entry" {
+		t.Errorf("got %q want entry", reason)
+	}
+}
+
+func TestReverseContinueToFunctionBreakpoint(t *testing.T) {
+	xs := recordTo(t, loopSource, dap.SourceBreakpoint{Line: 9, Condition: "i == 3"})
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], nil)
+	bp, _ := NewFunctionBreakpoint(dap.FunctionBreakpoint{Name: "square"})
+	xs.SetFunctionBreakpoints([]*Breakpoint{bp})
+	reason, err := xs.ReverseContinue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "function breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "x"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestReverseContinueToDataBreakpoint(t *testing.T) {
+	xs := recordTo(t, counterSource, dap.SourceBreakpoint{Line: 17})
+	xs.SetBreakpoints(xs.vm.pkg.GoFiles[0], nil)
+	watch(t, xs, "c.hits", dap.DataBreakpoint{})
+	reason, err := xs.ReverseContinue(func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "data breakpoint"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got, want := xs.DataWrite().Description(), "c.hits changed from 2 to 3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := evalString(t, xs, "c.hits"), "2"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
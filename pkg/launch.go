@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// decodeArgs returns the arguments for a call of a package function from a JSON array.
+// Each argument is decoded to the type of its parameter ; parameters of interpreted types are not supported.
+func (vm *VM) decodeArgs(functionName string, data []byte) (args []any, err error) {
+	fd, ok := vm.pkg.env.valueLookUp(functionName).Interface().(*FuncDecl)
+	if !ok || fd.recv != nil {
+		return nil, fmt.Errorf("function %s not found in package %s", functionName, vm.pkg.Name)
+	}
+	var raw []json.RawMessage
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("arguments of %s must be a JSON array: %v", functionName, err)
+		}
+	}
+	var params []*Field
+	if fd.typ.Params != nil {
+		for _, field := range fd.typ.Params.List {
+			for range field.names {
+				params = append(params, field)
+			}
+		}
+	}
+	if len(raw) != len(params) {
+		return nil, fmt.Errorf("function %s has %d parameter(s) but got %d argument(s)", functionName, len(params), len(raw))
+	}
+	defer func() {
+		// an unsupported parameter type is fatal for makeType
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cannot decode arguments of %s: %v", functionName, r)
+		}
+	}()
+	for i, each := range params {
+		typ := makeType(vm, each.typ)
+		if typ == structValueKeyType {
+			return nil, fmt.Errorf("cannot decode argument %d of %s: parameter has an interpreted type", i+1, functionName)
+		}
+		v := reflect.New(typ)
+		if err := json.Unmarshal(raw[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("cannot decode argument %d of %s: %v", i+1, functionName, err)
+		}
+		args = append(args, v.Elem().Interface())
+	}
+	return args, nil
+}
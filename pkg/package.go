@@ -17,6 +17,8 @@ type Package struct {
 	env               *PkgEnvironment
 	initialized       bool
 	callGraph         Step // the setup flow: declarations and calling inits
+	// contents of the files by name if parsed from source ; nil if the files are on disk
+	sources map[string][]byte
 }
 
 func (p *Package) selectByName(name string) reflect.Value {
@@ -28,6 +30,7 @@ func (p *Package) flow(g *graphBuilder) (head Step) {
 		// use for statement to eval all declarations until all are declared, then move to inits
 		doneVarName := internalVarName("done", g.idgen)
 		doneVar := Ident{name: doneVarName}
+		passVarName := internalVarName("pass", g.idgen)
 		falseLit := newBasicLit(token.NoPos, reflectFalse)
 		initDone := AssignStmt{
 			tok:    token.DEFINE,
@@ -55,23 +58,37 @@ func (p *Package) flow(g *graphBuilder) (head Step) {
 		for _, decl := range p.env.declarations {
 			body.list = append(body.list, decl)
 			// each decl will push the result (true,false)
-			updateDone := AssignStmt{
-				tok:    token.ASSIGN,
-				tokPos: token.NoPos,
-				lhs:    []Expr{doneVar},
-				rhs:    []Expr{noExpr{}}, // boolean result is already on stack
-			}
-			body.list = append(body.list, updateDone)
+			body.list = append(body.list, resolvedStmt{done: doneVarName, pass: passVarName})
 		}
+		body.list = append(body.list, progressStmt{pass: passVarName})
 		forStmt := ForStmt{
 			init: initDone,
 			cond: cond,
 			body: &body,
 		}
-		head = forStmt.flowWithOptions(g, true) // do not create a new environment for the loop
-		// remove done variable after resolving declarations
+		count := len(p.env.declarations)
+		head = newFuncStep(token.NoPos, "start passes", func(vm *VM) {
+			vm.currentEnv().valueSet(passVarName, reflect.ValueOf(&declarationPass{previous: count + 1}))
+		})
+		g.nextStep(head.(*funcStep))
+		forStmt.flowWithOptions(g, true) // do not create a new environment for the loop
+		// remove done variables after resolving declarations
 		g.nextStep(newFuncStep(token.NoPos, "unset done", func(vm *VM) {
 			vm.currentEnv().valueUnset(doneVarName)
+			vm.currentEnv().valueUnset(passVarName)
+		}))
+	}
+	// variables are sorted by their dependencies so each is initialized exactly once
+	for _, spec := range p.env.variables {
+		specHead := spec.flow(g)
+		if head == nil {
+			head = specHead
+		}
+		g.nextStep(newFuncStep(spec.pos(), "check initialized", func(vm *VM) {
+			// spec result
+			if vm.popOperand() == reflectFalse {
+				vm.fatalf("package variable not initialized: %v", spec.names)
+			}
 		}))
 	}
 	for i, funcDecl := range p.env.inits {
@@ -91,6 +108,114 @@ func (p *Package) flow(g *graphBuilder) (head Step) {
 	return
 }
 
+// declarationPass counts the package declarations that are not resolved in a pass over all of them.
+type declarationPass struct {
+	previous   int // unresolved in the previous pass
+	unresolved int
+}
+
+// resolvedStmt takes the result of a package declaration, pushed by its evaluation, and clears
+// the done variable if the declaration is not resolved, e.g. because it refers to a later declaration.
+type resolvedStmt struct {
+	done string // variable names
+	pass string
+}
+
+func (s resolvedStmt) stmtStep() Evaluable { return s }
+func (s resolvedStmt) pos() token.Pos      { return token.NoPos }
+func (s resolvedStmt) flow(g *graphBuilder) (head Step) {
+	g.next(s)
+	return g.current
+}
+func (s resolvedStmt) eval(vm *VM) {
+	if vm.popOperand() == reflectFalse {
+		vm.currentEnv().valueSet(s.done, reflectFalse)
+		vm.currentEnv().valueLookUp(s.pass).Interface().(*declarationPass).unresolved++
+	}
+}
+func (s resolvedStmt) String() string { return "resolvedStmt" }
+
+// progressStmt ends a pass over the package declarations. A pass that resolves none of the
+// unresolved declarations is a fatal error because they can never be resolved.
+type progressStmt struct {
+	pass string // variable name
+}
+
+func (s progressStmt) stmtStep() Evaluable { return s }
+func (s progressStmt) pos() token.Pos      { return token.NoPos }
+func (s progressStmt) flow(g *graphBuilder) (head Step) {
+	g.next(s)
+	return g.current
+}
+func (s progressStmt) eval(vm *VM) {
+	pass := vm.currentEnv().valueLookUp(s.pass).Interface().(*declarationPass)
+	if pass.unresolved > 0 && pass.unresolved >= pass.previous {
+		vm.fatalf("package declarations not initialized: %d cannot be resolved", pass.unresolved)
+	}
+	pass.previous, pass.unresolved = pass.unresolved, 0
+}
+func (s progressStmt) String() string { return "progressStmt" }
+
+// sortVariables moves all var declarations from the package declarations
+// into the list of variables, ordered as required by the Go spec.
+// The order is taken from the type checker, which also reports initialization cycles.
+// Without type information, the var declarations stay with the declarations.
+// https://go.dev/ref/spec#Package_initialization
+func (p *Package) sortVariables() {
+	type specIndex struct {
+		spec  ValueSpec
+		index int
+	}
+	initialized := map[token.Pos]specIndex{} // name position -> spec and index of the name
+	consts := []Stmt{}
+	for _, decl := range p.env.declarations {
+		cd, ok := decl.(ConstVarDecl)
+		// only package var specs need resolving
+		if !ok || len(cd.specs) == 0 || !cd.specs[0].needsResolving {
+			consts = append(consts, decl)
+			continue
+		}
+		if p.TypesInfo == nil {
+			// without type information there is no initialization order ;
+			// the declarations are evaluated until all are resolved, see flow
+			consts = append(consts, decl)
+			continue
+		}
+		for _, spec := range cd.specs {
+			if len(spec.values) == 0 {
+				// no initialization expression ; always ready for initialization
+				p.env.variables = append(p.env.variables, ValueSpec{names: spec.names, namePos: spec.namePos, typ: spec.typ})
+				continue
+			}
+			for i, name := range spec.names {
+				initialized[name.namePos] = specIndex{spec: spec, index: i}
+			}
+		}
+	}
+	p.env.declarations = consts
+	if p.TypesInfo == nil {
+		return
+	}
+	for _, each := range p.TypesInfo.InitOrder {
+		found, ok := initialized[each.Lhs[0].Pos()]
+		if !ok {
+			continue
+		}
+		if len(each.Lhs) > 1 || len(found.spec.values) != len(found.spec.names) {
+			// var a, b = f() ; keep as is
+			p.env.variables = append(p.env.variables, found.spec)
+			continue
+		}
+		name := found.spec.names[found.index]
+		p.env.variables = append(p.env.variables, ValueSpec{
+			names:   []Ident{name},
+			namePos: name.namePos,
+			typ:     found.spec.typ,
+			values:  []Expr{found.spec.values[found.index]},
+		})
+	}
+}
+
 func (p *Package) initializationStep() Step {
 	return newFuncStep(token.NoPos, "initialize "+p.Name, func(vm *VM) {
 		vm.pushNewFrame(nil) // this frame is popped in the last step of Package.flow
@@ -7,8 +7,10 @@ import (
 	"go/token"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/tools/go/packages"
@@ -61,37 +63,95 @@ func RegisterFunction(pkgPath string, funcName string, fn reflect.Value) {
 	importedPkgs[pkgPath] = vant
 }
 
+// LoadPackage loads the Go package in a directory, or the package of a single Go source file if dir names one.
 func LoadPackage(dir string, optionalConfig *packages.Config) (*packages.Package, error) {
 	if dir == "" {
 		return nil, fmt.Errorf("directory must be specified")
 	}
+	// a single Go source file is a package of its own, as with go run
+	pattern := "."
+	if strings.HasSuffix(dir, ".go") {
+		pattern = "./" + filepath.Base(dir)
+		dir = filepath.Dir(dir)
+	}
 	var cfg *packages.Config
 	if optionalConfig != nil {
 		cfg = optionalConfig
 	} else {
 		cfg = &packages.Config{
-			Mode: loadMode,
-			Fset: token.NewFileSet(),
-			Dir:  dir,
-			// set the [parser.SkipObjectResolution] parser flag to disable syntactic object resolution
-			ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
-				return parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
-			},
+			Mode:      loadMode,
+			Fset:      token.NewFileSet(),
+			Dir:       dir,
+			ParseFile: parseFile,
 		}
 	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load package: %v", err)
+	}
+	if err := loadError(pkgs); err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages found")
+	}
+	return pkgs[0], nil
+}
+
+// LoadTestPackage loads the Go package in a directory together with its test files.
+// Test files of the external test package, the one with the _test suffix, are not loaded.
+func LoadTestPackage(dir string) (*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode:  loadMode,
+		Fset:  token.NewFileSet(),
+		Dir:   dir,
+		Tests: true,
+		// examples need their output comments
+		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			return parser.ParseFile(fset, filename, src, parser.SkipObjectResolution|parser.ParseComments)
+		},
+	}
 	pkgs, err := packages.Load(cfg, ".")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load package: %v", err)
 	}
-	if count := packages.PrintErrors(pkgs); count > 0 {
-		return nil, fmt.Errorf("errors during package loading: %d", count)
+	if err := loadError(pkgs); err != nil {
+		return nil, err
 	}
 	if len(pkgs) == 0 {
 		return nil, fmt.Errorf("no packages found")
 	}
+	// the variant with test files has an ID such as "example.com/p [example.com/p.test]"
+	for _, each := range pkgs {
+		if strings.HasSuffix(each.ID, ".test]") && !strings.HasSuffix(each.PkgPath, "_test") {
+			return each, nil
+		}
+	}
+	// without test files
 	return pkgs[0], nil
 }
 
+// loadError prints the errors of loaded packages and their imports and returns an error with the first one, if any.
+func loadError(pkgs []*packages.Package) error {
+	count := packages.PrintErrors(pkgs)
+	if count == 0 {
+		return nil
+	}
+	var first error
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if first == nil && len(p.Errors) > 0 {
+			first = p.Errors[0]
+		}
+	})
+	return fmt.Errorf("errors during package loading: %d, first: %v", count, first)
+}
+
+// parseFile parses a file for packages.Load.
+// It sets the [parser.SkipObjectResolution] parser flag to disable syntactic object resolution.
+func parseFile(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	return parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+}
+
 func BuildPackage(goPkg *packages.Package) (*Package, error) {
 	if trace {
 		now := time.Now()
@@ -99,6 +159,8 @@ func BuildPackage(goPkg *packages.Package) (*Package, error) {
 			fmt.Printf("pkg.build(%s) took %v\n", goPkg.PkgPath, time.Since(now))
 		}()
 	}
+	// taken on every path, also when the build fails
+	sources := takeParsedSources(goPkg)
 	b := newASTBuilder(goPkg)
 	for _, stx := range goPkg.Syntax {
 		for _, decl := range stx.Decls {
@@ -109,7 +171,10 @@ func BuildPackage(goPkg *packages.Package) (*Package, error) {
 			}
 		}
 	}
-	pkg := &Package{Package: goPkg, env: b.env.(*PkgEnvironment)}
+	pkg := &Package{Package: goPkg, env: b.env.(*PkgEnvironment), sources: sources}
+
+	// package variables are initialized in dependency order across all files
+	pkg.sortVariables()
 
 	// build and store package setup flow
 	gb := newGraphBuilder(goPkg)
@@ -127,12 +192,13 @@ func BuildPackage(goPkg *packages.Package) (*Package, error) {
 	return pkg, nil
 }
 
-func CallPackageFunction(pkg *Package, functionName string, args []any) ([]any, error) {
-	return NewVM(pkg).callPackageFunction(functionName, args)
+func CallPackageFunction(pkg *Package, functionName string, args []any, options ...VMOption) ([]any, error) {
+	return NewVM(pkg, options...).callPackageFunction(functionName, args)
 }
 
 // ParseSource is a helper function that allows parsing and building a package directly from a source string, without needing to read from the filesystem.
 // It creates a temporary directory, writes the source to a main.go file, and then uses the standard LoadPackage.
+// The directory is removed ; the source is kept in memory for debuggers until the package is built.
 func ParseSource(source string) (*packages.Package, error) {
 
 	// create a temp dir with a main.go file and go.mod
@@ -152,13 +218,29 @@ func ParseSource(source string) (*packages.Package, error) {
 	}
 	defer os.RemoveAll(dir) // Clean up
 
+	var contentsMutex sync.Mutex // files can be parsed concurrently
+	contents := map[string][]byte{}
 	cfg := &packages.Config{
 		Mode: loadMode,
 		Fset: token.NewFileSet(),
 		Dir:  dir,
 		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			contentsMutex.Lock()
+			contents[filename] = src
+			contentsMutex.Unlock()
 			return parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
 		},
 	}
-	return LoadPackage(cfg.Dir, cfg)
+	goPkg, err := LoadPackage(cfg.Dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	sources := map[string][]byte{}
+	for _, each := range goPkg.GoFiles {
+		if content, ok := contents[each]; ok {
+			sources[each] = content
+		}
+	}
+	keepParsedSources(goPkg, sources)
+	return goPkg, nil
 }
@@ -69,3 +69,35 @@ func main() {
 }`, `gi
 `)
 }
+
+func TestSortVariablesWithoutTypesInfo(t *testing.T) {
+	gopkg, err := ParseSource(`package main
+
+var a = b + 1
+var b, c = 1, 2
+var d int
+
+func main() {
+	print(a, b, c, d)
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newASTBuilder(gopkg)
+	for _, each := range gopkg.Syntax[0].Decls {
+		b.Visit(each)
+	}
+	untyped := *gopkg
+	untyped.TypesInfo = nil
+	p := &Package{Package: &untyped, env: b.env.(*PkgEnvironment)}
+	p.sortVariables()
+	p.callGraph = p.flow(newGraphBuilder(&untyped))
+	vm := NewVM(p)
+	collectPrintOutput(vm)
+	if _, err := vm.callPackageFunction("main", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := vm.output.String(), "2120"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
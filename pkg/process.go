@@ -0,0 +1,217 @@
+package pkg
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// WithArgs sets the command-line arguments of the program as seen by os.Args, starting with the program name.
+// Without this option, os.Args are those of the process that runs the VM.
+// The program gets its own flag.CommandLine, named after the program ; flag.Parse parses the arguments after the program name.
+// A parse error, or a request for help, ends the program with exit code 2.
+func WithArgs(args ...string) VMOption {
+	return func(vm *VM) {
+		vm.replaceStd("os.Args", reflect.ValueOf(args))
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		vm.replaceStd("flag.CommandLine", reflect.ValueOf(fs))
+		for _, each := range flagSetFunctions {
+			vm.replaceStd("flag."+each, reflect.ValueOf(fs).MethodByName(each))
+		}
+		vm.replaceStd("flag.Parse", reflect.ValueOf(func() {
+			if stderr, ok := vm.std["os"]["Stderr"]; ok {
+				fs.SetOutput(stderr.Interface().(io.Writer))
+			}
+			if len(args) == 0 {
+				return
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				vm.exitCode = 2
+				vm.exited = true
+			}
+		}))
+	}
+}
+
+// flagSetFunctions are the functions of the flag package that act on flag.CommandLine and are methods of a flag.FlagSet.
+var flagSetFunctions = []string{"Arg", "Args", "Bool", "BoolFunc", "BoolVar", "Duration", "DurationVar",
+	"Float64", "Float64Var", "Func", "Int", "Int64", "Int64Var", "IntVar", "Lookup", "NArg", "NFlag",
+	"Parsed", "PrintDefaults", "Set", "String", "StringVar", "TextVar", "Uint", "Uint64", "Uint64Var",
+	"UintVar", "Var", "Visit", "VisitAll"}
+
+// WithEnv sets environment variables of the program in addition to those of the process.
+// The program sees them with os.Getenv, os.LookupEnv, os.Environ and os.ExpandEnv ; its changes by os.Setenv,
+// os.Unsetenv and os.Clearenv are not made to the environment of the process.
+func WithEnv(env map[string]string) VMOption {
+	return func(vm *VM) {
+		vars := map[string]string{}
+		for _, each := range os.Environ() {
+			if k, v, ok := strings.Cut(each, "="); ok {
+				vars[k] = v
+			}
+		}
+		maps.Copy(vars, env)
+		getenv := func(key string) string { return vars[key] }
+		vm.replaceStd("os.Getenv", reflect.ValueOf(getenv))
+		vm.replaceStd("os.LookupEnv", reflect.ValueOf(func(key string) (string, bool) {
+			v, ok := vars[key]
+			return v, ok
+		}))
+		vm.replaceStd("os.Environ", reflect.ValueOf(func() []string {
+			list := make([]string, 0, len(vars))
+			for _, k := range slices.Sorted(maps.Keys(vars)) {
+				list = append(list, k+"="+vars[k])
+			}
+			return list
+		}))
+		vm.replaceStd("os.ExpandEnv", reflect.ValueOf(func(s string) string { return os.Expand(s, getenv) }))
+		vm.replaceStd("os.Setenv", reflect.ValueOf(func(key, value string) error {
+			vars[key] = value
+			return nil
+		}))
+		vm.replaceStd("os.Unsetenv", reflect.ValueOf(func(key string) error {
+			delete(vars, key)
+			return nil
+		}))
+		vm.replaceStd("os.Clearenv", reflect.ValueOf(func() { clear(vars) }))
+	}
+}
+
+// WithDir sets the working directory of the program as seen by os.Getwd and changed by os.Chdir.
+// Relative paths given to os.Open, os.OpenFile, os.Create, os.ReadFile, os.WriteFile, os.Stat, os.Lstat, os.ReadDir,
+// os.Mkdir, os.MkdirAll, os.Remove and os.RemoveAll are relative to it ; other functions, such as those of
+// os/exec or path/filepath.Abs, use the working directory of the process.
+func WithDir(dir string) VMOption {
+	return func(vm *VM) {
+		abs := func(name string) string {
+			if name == "" || filepath.IsAbs(name) {
+				return name
+			}
+			return filepath.Join(dir, name)
+		}
+		vm.replaceStd("os.Getwd", reflect.ValueOf(func() (string, error) { return dir, nil }))
+		vm.replaceStd("os.Chdir", reflect.ValueOf(func(name string) error {
+			info, err := os.Stat(abs(name))
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return &os.PathError{Op: "chdir", Path: name, Err: syscall.ENOTDIR}
+			}
+			dir = abs(name)
+			return nil
+		}))
+		vm.replaceStd("os.Open", reflect.ValueOf(func(name string) (*os.File, error) { return os.Open(abs(name)) }))
+		vm.replaceStd("os.OpenFile", reflect.ValueOf(func(name string, flag int, perm os.FileMode) (*os.File, error) {
+			return os.OpenFile(abs(name), flag, perm)
+		}))
+		vm.replaceStd("os.Create", reflect.ValueOf(func(name string) (*os.File, error) { return os.Create(abs(name)) }))
+		vm.replaceStd("os.ReadFile", reflect.ValueOf(func(name string) ([]byte, error) { return os.ReadFile(abs(name)) }))
+		vm.replaceStd("os.WriteFile", reflect.ValueOf(func(name string, data []byte, perm os.FileMode) error {
+			return os.WriteFile(abs(name), data, perm)
+		}))
+		vm.replaceStd("os.Stat", reflect.ValueOf(func(name string) (os.FileInfo, error) { return os.Stat(abs(name)) }))
+		vm.replaceStd("os.Lstat", reflect.ValueOf(func(name string) (os.FileInfo, error) { return os.Lstat(abs(name)) }))
+		vm.replaceStd("os.ReadDir", reflect.ValueOf(func(name string) ([]os.DirEntry, error) { return os.ReadDir(abs(name)) }))
+		vm.replaceStd("os.Mkdir", reflect.ValueOf(func(name string, perm os.FileMode) error { return os.Mkdir(abs(name), perm) }))
+		vm.replaceStd("os.MkdirAll", reflect.ValueOf(func(name string, perm os.FileMode) error { return os.MkdirAll(abs(name), perm) }))
+		vm.replaceStd("os.Remove", reflect.ValueOf(func(name string) error { return os.Remove(abs(name)) }))
+		vm.replaceStd("os.RemoveAll", reflect.ValueOf(func(name string) error { return os.RemoveAll(abs(name)) }))
+	}
+}
+
+// WithOutput makes the program write to stdout and stderr instead of those of the process.
+// They replace os.Stdout and os.Stderr and are used by the print functions of fmt and the builtin print functions.
+func WithOutput(stdout, stderr *os.File) VMOption {
+	return func(vm *VM) {
+		vm.replaceStd("os.Stdout", reflect.ValueOf(stdout))
+		vm.replaceStd("os.Stderr", reflect.ValueOf(stderr))
+		vm.replacePrint(stdout)
+	}
+}
+
+// replacePrint makes the print functions of fmt and the builtin print functions write to w.
+func (vm *VM) replacePrint(w io.Writer) {
+	vm.replaceStd("fmt.Print", reflect.ValueOf(func(a ...any) (int, error) { return fmt.Fprint(w, a...) }))
+	vm.replaceStd("fmt.Println", reflect.ValueOf(func(a ...any) (int, error) { return fmt.Fprintln(w, a...) }))
+	vm.replaceStd("fmt.Printf", reflect.ValueOf(func(format string, a ...any) (int, error) { return fmt.Fprintf(w, format, a...) }))
+	vm.replaceStd("print", reflect.ValueOf(func(args ...any) { fmt.Fprint(w, args...) }))
+	vm.replaceStd("println", reflect.ValueOf(func(args ...any) { fmt.Fprintln(w, args...) }))
+}
+
+// WithOsExit makes os.Exit end the program instead of the process. The code is available from ExitCode.
+// Deferred functions are not run, as with the Go SDK os.Exit.
+func WithOsExit() VMOption {
+	return func(vm *VM) {
+		vm.replaceStd("os.Exit", reflect.ValueOf(func(code int) {
+			vm.exitCode = code
+			vm.exited = true
+		}))
+	}
+}
+
+// ExitCode returns the code passed to os.Exit if the program called it and WithOsExit was used ; 0 otherwise.
+func (vm *VM) ExitCode() int {
+	return vm.exitCode
+}
+
+// ExitError is returned by CallPackageFunction if the program called os.Exit with a non-zero code and WithOsExit was used.
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// replaceStd replaces a symbol of a standard package, named by package path and name, or a builtin for this VM only.
+func (vm *VM) replaceStd(name string, v reflect.Value) {
+	if vm.std == nil {
+		vm.std = map[string]map[string]reflect.Value{}
+	}
+	pkgPath := ""
+	if dot := strings.LastIndex(name, "."); dot != -1 {
+		pkgPath, name = name[:dot], name[dot+1:]
+	}
+	if vm.std[pkgPath] == nil {
+		vm.std[pkgPath] = map[string]reflect.Value{}
+	}
+	vm.std[pkgPath][name] = v
+}
+
+// selectStd returns the replacement of a selected symbol of a standard package, if any.
+func (vm *VM) selectStd(rec CanSelect, name string, sel reflect.Value) reflect.Value {
+	if vm.std == nil {
+		return sel
+	}
+	if p, ok := rec.(SDKPackage); ok {
+		if v, ok := vm.std[p.pkgPath][name]; ok {
+			return v
+		}
+	}
+	return sel
+}
+
+// lookUpStd returns the replacement of a builtin function, if any and if the name is not redeclared.
+func (vm *VM) lookUpStd(name string, v reflect.Value) reflect.Value {
+	if vm.std == nil || v.Kind() != reflect.Func {
+		return v
+	}
+	if r, ok := vm.std[""][name]; ok {
+		if b, ok := builtins[name]; ok && b.Kind() == reflect.Func && b.Pointer() == v.Pointer() {
+			return r
+		}
+	}
+	return v
+}
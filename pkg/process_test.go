@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// runToEnd launches main and takes steps until the program has ended.
+func runToEnd(t *testing.T, vm *VM) {
+	t.Helper()
+	vm.Launch("main", nil)
+	for {
+		if err := vm.Next(); err != nil {
+			if err == io.EOF {
+				return
+			}
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWithOutput(t *testing.T) {
+	dir := t.TempDir()
+	stdout, _ := os.Create(filepath.Join(dir, "stdout"))
+	stderr, _ := os.Create(filepath.Join(dir, "stderr"))
+	vm := NewVM(buildPackage(t, `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("hello", 42)
+	fmt.Printf("%s!", "world")
+	print("x")
+	fmt.Fprint(os.Stderr, "oops")
+}`), WithOutput(stdout, stderr))
+	runToEnd(t, vm)
+	stdout.Close()
+	stderr.Close()
+	if got, want := readFile(t, stdout.Name()), "hello 42\nworld!x"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := readFile(t, stderr.Name()), "oops"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestWithOutputRedeclaredPrint(t *testing.T) {
+	dir := t.TempDir()
+	stdout, _ := os.Create(filepath.Join(dir, "stdout"))
+	vm := NewVM(buildPackage(t, `package main
+
+import "fmt"
+
+func main() {
+	print("a")
+	print := func(s string) { fmt.Print("<", s, ">") }
+	print("b")
+}`), WithOutput(stdout, os.Stderr))
+	runToEnd(t, vm)
+	stdout.Close()
+	if got, want := readFile(t, stdout.Name()), "a<b>"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestWithOsExit(t *testing.T) {
+	vm := NewVM(buildPackage(t, `package main
+
+import "os"
+
+func main() {
+	defer panic("not run")
+	os.Exit(3)
+	panic("not reached")
+}`), WithOsExit())
+	runToEnd(t, vm)
+	if got, want := vm.ExitCode(), 3; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestWithArgs(t *testing.T) {
+	vm := NewVM(buildPackage(t, `package main
+
+import "os"
+
+func main() {
+	os.Exit(len(os.Args[1]))
+}`), WithArgs("prog", "four"), WithOsExit())
+	runToEnd(t, vm)
+	if got, want := vm.ExitCode(), 4; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestWithArgsFlagParse(t *testing.T) {
+	vm := NewVM(buildPackage(t, `package main
+
+import (
+	"flag"
+	"os"
+)
+
+func main() {
+	n := flag.Int("gi-test-n", 0, "")
+	flag.Parse()
+	os.Exit(*n + flag.NArg())
+}`), WithArgs("prog", "-gi-test-n", "3", "input.txt"), WithOsExit())
+	runToEnd(t, vm)
+	if got, want := vm.ExitCode(), 4; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+const flagSource = `package main
+
+import (
+	"flag"
+	"os"
+)
+
+func main() {
+	n := flag.Int("n", 0, "")
+	flag.Parse()
+	os.Exit(*n + flag.NArg())
+}`
+
+func TestWithArgsFlagParseTwice(t *testing.T) {
+	pkg := buildPackage(t, flagSource)
+	for _, each := range []string{"1", "2"} {
+		// each run defines its flags anew
+		_, err := CallPackageFunction(pkg, "main", nil, WithArgs("prog", "-n", each), WithOsExit())
+		exit, ok := err.(ExitError)
+		if !ok {
+			t.Fatalf("got %v", err)
+		}
+		if got, want := strconv.Itoa(exit.Code), each; got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	}
+}
+
+func TestWithArgsUnknownFlag(t *testing.T) {
+	dir := t.TempDir()
+	stdout, _ := os.Create(filepath.Join(dir, "stdout"))
+	stderr, _ := os.Create(filepath.Join(dir, "stderr"))
+	_, err := CallPackageFunction(buildPackage(t, flagSource), "main", nil,
+		WithArgs("prog", "-m", "1"), WithOutput(stdout, stderr), WithOsExit())
+	stderr.Close()
+	if got, want := err, (ExitError{Code: 2}); got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if got, want := readFile(t, stderr.Name()), "flag provided but not defined: -m"; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q want prefix %q", got, want)
+	}
+}
+
+func TestCallPackageFunctionExitError(t *testing.T) {
+	pkg := buildPackage(t, `package main
+
+import "os"
+
+func main() {
+	os.Exit(5)
+}`)
+	_, err := CallPackageFunction(pkg, "main", nil, WithOsExit())
+	exit, ok := err.(ExitError)
+	if !ok {
+		t.Fatalf("got %v", err)
+	}
+	if got, want := exit.Code, 5; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestLoadPackageOfFile(t *testing.T) {
+	gopkg, err := LoadPackage("../examples/script/hello.go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(gopkg.GoFiles), 1; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	vm := NewVM(buildPackage(t, `package main
+
+import "os"
+
+func main() {
+	os.Setenv("GI_TEST_ENV", os.Getenv("GI_TEST_ENV")+"!")
+	v, _ := os.LookupEnv("GI_TEST_ENV")
+	os.Exit(len(v))
+}`), WithEnv(map[string]string{"GI_TEST_ENV": "abc"}), WithOsExit())
+	runToEnd(t, vm)
+	if got, want := vm.ExitCode(), 4; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if _, ok := os.LookupEnv("GI_TEST_ENV"); ok {
+		t.Error("expected no change of the process environment")
+	}
+}
+
+func TestWithDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data", "input.txt"), []byte("four"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vm := NewVM(buildPackage(t, `package main
+
+import "os"
+
+func main() {
+	os.Chdir("data")
+	data, _ := os.ReadFile("input.txt")
+	wd, _ := os.Getwd()
+	os.WriteFile("output.txt", []byte(wd), 0644)
+	os.Exit(len(data))
+}`), WithDir(dir), WithOsExit())
+	runToEnd(t, vm)
+	if got, want := vm.ExitCode(), 4; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if got, want := readFile(t, filepath.Join(dir, "data", "output.txt")), filepath.Join(dir, "data"); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
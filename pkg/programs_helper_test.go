@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -36,6 +37,30 @@ func buildPackage(t *testing.T, source string) *Package {
 	return giPkg
 }
 
+// buildModule writes the files of a module, by their path relative to the module, and builds its main package.
+func buildModule(t *testing.T, files map[string]string) (*Package, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	goPkg, err := LoadPackage(dir, nil)
+	if err != nil {
+		t.Fatalf("failed to load package: %v", err)
+	}
+	giPkg, err := BuildPackage(goPkg)
+	if err != nil {
+		t.Fatalf("failed to build package: %v", err)
+	}
+	return giPkg, dir
+}
+
 // this print function outputs are different from the standard and is only used for tests
 func collectPrintOutput(vm *VM) {
 	vm.pkg.env.valueSet("print", reflect.ValueOf(func(args ...any) {
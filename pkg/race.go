@@ -0,0 +1,340 @@
+package pkg
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// WithRaceDetector makes the VM detect unsynchronized conflicting accesses to variables, struct fields
+// and heap values by interpreted goroutines. Each race is reported once to w, in the style of go run -race.
+func WithRaceDetector(w io.Writer) VMOption {
+	return func(vm *VM) {
+		vm.race = &raceDetector{
+			vm:        vm,
+			output:    w,
+			clocks:    map[int]vectorClock{},
+			syncs:     map[any]vectorClock{},
+			shadows:   map[raceKey]*raceShadow{},
+			creations: map[int][]frameLocation{},
+			reported:  map[[2]token.Pos]bool{},
+		}
+		vm.heap.race = vm.race
+		// package variables can be accessed by all routines
+		vm.pkg.env.Env.(*Environment).isShared = true
+		for _, each := range vm.pkg.env.packages {
+			if env, ok := each.env.Env.(*Environment); ok {
+				env.isShared = true
+			}
+		}
+	}
+}
+
+// RaceError is returned after a run in which data races were detected.
+type RaceError struct {
+	Count int
+}
+
+func (e RaceError) Error() string {
+	return fmt.Sprintf("found %d data race(s)", e.Count)
+}
+
+// Races returns the number of data races reported so far.
+func (vm *VM) Races() int {
+	if vm.race == nil {
+		return 0
+	}
+	return vm.race.count
+}
+
+// vectorClock holds the logical time per routine id.
+type vectorClock map[int]uint64
+
+func (c vectorClock) join(other vectorClock) {
+	for id, t := range other {
+		if t > c[id] {
+			c[id] = t
+		}
+	}
+}
+
+func (c vectorClock) clone() vectorClock {
+	d := make(vectorClock, len(c))
+	for id, t := range c {
+		d[id] = t
+	}
+	return d
+}
+
+// raceKey identifies a memory location: a variable in an environment, a field of a struct value or a heap value.
+type raceKey struct {
+	owner any
+	name  string
+	addr  uintptr
+}
+
+// raceAccess is a read or write of a memory location by a routine.
+type raceAccess struct {
+	routine int
+	epoch   uint64 // clock of the routine at the time of access
+	write   bool
+	stack   []frameLocation
+}
+
+// raceShadow holds the last write and the reads since that write of a memory location.
+type raceShadow struct {
+	write *raceAccess
+	reads map[int]*raceAccess // by routine id
+}
+
+// raceDetector tracks happens-before relations between routines using vector clocks.
+// Synchronization by channels, mutexes, wait groups and go statements is modeled by release and acquire.
+type raceDetector struct {
+	vm        *VM
+	output    io.Writer
+	clocks    map[int]vectorClock // by routine id
+	syncs     map[any]vectorClock // by channel or sync object
+	shadows   map[raceKey]*raceShadow
+	creations map[int][]frameLocation // stack of the go statement by routine id
+	reported  map[[2]token.Pos]bool
+	count     int
+}
+
+// routineId returns the id of the running routine ; the main routine before any go statement.
+func (d *raceDetector) routineId() int {
+	if d.vm.routine == nil {
+		return 1
+	}
+	return d.vm.routine.id
+}
+
+func (d *raceDetector) clock(id int) vectorClock {
+	c, ok := d.clocks[id]
+	if !ok {
+		c = vectorClock{id: 1}
+		d.clocks[id] = c
+	}
+	return c
+}
+
+// release publishes the clock of the running routine to the sync object.
+func (d *raceDetector) release(obj any) {
+	id := d.routineId()
+	c := d.clock(id)
+	s, ok := d.syncs[obj]
+	if !ok {
+		s = vectorClock{}
+		d.syncs[obj] = s
+	}
+	s.join(c)
+	c[id]++
+}
+
+// acquire makes everything published to the sync object happen before the next accesses of the running routine.
+func (d *raceDetector) acquire(obj any) {
+	if s, ok := d.syncs[obj]; ok {
+		d.clock(d.routineId()).join(s)
+	}
+}
+
+// acquireOnWake acquires the sync object when the running routine, which just parked, is woken up.
+func (d *raceDetector) acquireOnWake(obj any) {
+	r := d.vm.routine
+	onWake := r.onWake
+	r.onWake = func(vm *VM, chosen int, recv reflect.Value, recvOK bool) {
+		if onWake != nil {
+			onWake(vm, chosen, recv, recvOK)
+		}
+		d.acquire(obj)
+	}
+}
+
+// started is called when the running routine has executed a go statement for r.
+func (d *raceDetector) started(r *routine, goPos token.Pos) {
+	id := d.routineId()
+	parent := d.clock(id)
+	child := parent.clone()
+	child[r.id] = 1
+	d.clocks[r.id] = child
+	parent[id]++
+	d.creations[r.id] = d.vm.stackLocations(d.vm.callStack, goPos)
+}
+
+// handedOff is called when a sender and receiver have met on an unbuffered channel.
+func (d *raceDetector) handedOff(sender, receiver *routine) {
+	s, r := d.clock(sender.id), d.clock(receiver.id)
+	s.join(r)
+	r.join(s)
+	s[sender.id]++
+	r[receiver.id]++
+}
+
+// syncMethods holds the SDK methods that synchronize routines ; true if the method acquires, false if it releases.
+var syncMethods = map[reflect.Type]map[string]bool{
+	reflect.TypeFor[*sync.Mutex]():     {"Lock": true, "TryLock": true, "Unlock": false},
+	reflect.TypeFor[*sync.RWMutex]():   {"Lock": true, "RLock": true, "TryLock": true, "TryRLock": true, "Unlock": false, "RUnlock": false},
+	reflect.TypeFor[*sync.WaitGroup](): {"Wait": true, "Done": false, "Add": false},
+}
+
+// isSyncMethod returns true if the SDK method synchronizes routines.
+func isSyncMethod(recvType reflect.Type, name string) bool {
+	_, ok := syncMethods[recvType][name]
+	return ok
+}
+
+var closeFuncPointer = builtins["close"].Pointer()
+
+// beforeCall releases if the SDK function publishes to other routines.
+func (d *raceDetector) beforeCall(fn reflect.Value, args []reflect.Value) {
+	if fn.Pointer() == closeFuncPointer && len(args) == 1 {
+		d.release(syncObject(args[0]))
+	}
+}
+
+// beforeMethodCall releases if the method publishes to other routines.
+// It returns the sync object to acquire after the call, if any.
+func (d *raceDetector) beforeMethodCall(rm reflect.Method, recv reflect.Value) (acquire any) {
+	acquires, ok := syncMethods[rm.Type.In(0)][rm.Name]
+	if !ok {
+		return nil
+	}
+	obj := syncObject(recv)
+	if !acquires {
+		d.release(obj)
+		return nil
+	}
+	return obj
+}
+
+// syncObject returns the identity of a channel or sync value.
+func syncObject(v reflect.Value) any {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Chan || v.Kind() == reflect.Pointer {
+		return v.Pointer()
+	}
+	return v.Interface()
+}
+
+// readVar checks the read of a variable from the environment chain.
+func (d *raceDetector) readVar(env Env, name string) {
+	if owner, _ := env.valueOwnerOf(name); isTrackedEnv(owner) {
+		d.access(raceKey{owner: owner, name: name}, false)
+	}
+}
+
+// writeVar checks the write of a variable in its owning environment.
+func (d *raceDetector) writeVar(owner Env, name string) {
+	if isTrackedEnv(owner) {
+		d.access(raceKey{owner: owner, name: name}, true)
+	}
+}
+
+// defineVar forgets earlier accesses of a variable because a new one is declared.
+func (d *raceDetector) defineVar(env Env, name string) {
+	delete(d.shadows, raceKey{owner: env, name: name})
+}
+
+// isTrackedEnv returns true if the environment can be accessed by more than one routine.
+// Environments that are not shared are recycled so their accesses are not tracked.
+func isTrackedEnv(env Env) bool {
+	e, ok := env.(*Environment)
+	return ok && e.isShared
+}
+
+// access checks the read or write of a memory location for conflicts with earlier accesses by other routines.
+func (d *raceDetector) access(key raceKey, write bool) {
+	id := d.routineId()
+	c := d.clock(id)
+	shadow, ok := d.shadows[key]
+	if !ok {
+		shadow = &raceShadow{reads: map[int]*raceAccess{}}
+		d.shadows[key] = shadow
+	}
+	current := &raceAccess{routine: id, epoch: c[id], write: write, stack: d.vm.stackLocations(d.vm.callStack, d.currentPos())}
+	if w := shadow.write; w != nil && w.routine != id && w.epoch > c[w.routine] {
+		d.report(key, current, w)
+	}
+	if write {
+		for _, r := range shadow.reads {
+			if r.routine != id && r.epoch > c[r.routine] {
+				d.report(key, current, r)
+				break
+			}
+		}
+	}
+	if write {
+		shadow.write = current
+		clear(shadow.reads)
+		return
+	}
+	shadow.reads[id] = current
+}
+
+func (d *raceDetector) currentPos() token.Pos {
+	if f := d.vm.currentFrame; f != nil && f.step != nil {
+		return f.step.pos()
+	}
+	return token.NoPos
+}
+
+// report writes the conflicting accesses, once per pair of positions.
+func (d *raceDetector) report(key raceKey, current, previous *raceAccess) {
+	pair := [2]token.Pos{topPos(current.stack), topPos(previous.stack)}
+	if d.reported[pair] {
+		return
+	}
+	d.reported[pair] = true
+	d.count++
+
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, "==================")
+	fmt.Fprintln(buf, "WARNING: DATA RACE")
+	fmt.Fprintf(buf, "%s of %s by goroutine %d:\n", accessKind(current, false), key.describe(), current.routine)
+	d.vm.writeFrames(buf, current.stack, "  ")
+	fmt.Fprintln(buf)
+	fmt.Fprintf(buf, "%s of %s by goroutine %d:\n", accessKind(previous, true), key.describe(), previous.routine)
+	d.vm.writeFrames(buf, previous.stack, "  ")
+	for _, id := range []int{current.routine, previous.routine} {
+		if created, ok := d.creations[id]; ok {
+			fmt.Fprintln(buf)
+			fmt.Fprintf(buf, "Goroutine %d created at:\n", id)
+			d.vm.writeFrames(buf, created, "  ")
+		}
+	}
+	fmt.Fprintln(buf, "==================")
+	io.WriteString(d.output, buf.String())
+}
+
+// accessKind returns "Read" or "Write", or "Previous read" or "Previous write".
+func accessKind(a *raceAccess, previous bool) string {
+	kind := "read"
+	if a.write {
+		kind = "write"
+	}
+	if previous {
+		return "Previous " + kind
+	}
+	return strings.ToUpper(kind[:1]) + kind[1:]
+}
+
+func topPos(stack []frameLocation) token.Pos {
+	if len(stack) == 0 {
+		return token.NoPos
+	}
+	return stack[0].pos
+}
+
+func (k raceKey) describe() string {
+	switch k.owner.(type) {
+	case *Heap:
+		return fmt.Sprintf("heap value 0x%x", k.addr)
+	case *map[string]reflect.Value:
+		return "field " + k.name
+	}
+	return "variable " + k.name
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func runWithRaceDetector(t *testing.T, source string) (string, *VM) {
+	t.Helper()
+	report := new(bytes.Buffer)
+	vm := NewVM(buildPackage(t, source), WithRaceDetector(report))
+	collectPrintOutput(vm)
+	vm.launch("main", nil)
+	for {
+		if err := vm.Next(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+	}
+	return report.String(), vm
+}
+
+func TestRaceUnsynchronizedWrite(t *testing.T) {
+	report, vm := runWithRaceDetector(t, `package main
+
+import "time"
+
+func main() {
+	count := 0
+	go func() {
+		count = 1
+	}()
+	time.Sleep(10 * time.Millisecond)
+	print(count)
+}`)
+	if vm.Races() != 1 {
+		t.Fatalf("got %d races, report:\n%s", vm.Races(), report)
+	}
+	for _, want := range []string{
+		"WARNING: DATA RACE",
+		"Read of variable count by goroutine 1:\n  main.main(...)\n",
+		"Previous write of variable count by goroutine 2:\n  main.main.func1(...)\n",
+		"Goroutine 2 created at:\n  main.main(...)\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("got %q want to contain %q", report, want)
+		}
+	}
+}
+
+func TestRaceSynchronizedByChannel(t *testing.T) {
+	report, vm := runWithRaceDetector(t, `package main
+
+func main() {
+	count := 0
+	done := make(chan bool)
+	go func() {
+		count = 1
+		done <- true
+	}()
+	<-done
+	print(count)
+}`)
+	if vm.Races() != 0 {
+		t.Fatalf("got %d races, report:\n%s", vm.Races(), report)
+	}
+}
+
+func TestRaceSynchronizedByMutexAndWaitGroup(t *testing.T) {
+	report, vm := runWithRaceDetector(t, `package main
+
+import "sync"
+
+type counter struct {
+	n int
+}
+
+func main() {
+	c := new(counter)
+	mu := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			mu.Lock()
+			c.n = c.n + 1
+			mu.Unlock()
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	print(c.n)
+}`)
+	if vm.Races() != 0 {
+		t.Fatalf("got %d races, report:\n%s", vm.Races(), report)
+	}
+}
+
+func TestRaceStructField(t *testing.T) {
+	report, vm := runWithRaceDetector(t, `package main
+
+import "sync"
+
+type counter struct {
+	n int
+}
+
+func main() {
+	c := new(counter)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			c.n = c.n + 1
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}`)
+	if vm.Races() == 0 {
+		t.Fatal("expected race")
+	}
+	if !strings.Contains(report, "of field n by goroutine") {
+		t.Errorf("got %q", report)
+	}
+}
@@ -0,0 +1,372 @@
+package pkg
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// routineQuantum is the number of steps a routine can take before the scheduler switches to another runnable routine.
+const routineQuantum = 64
+
+// deadlockGrace is how long the scheduler waits for any progress before reporting a deadlock.
+const deadlockGrace = 50 * time.Millisecond
+
+// kinds of waits of a routine
+const (
+	waitChannel  = iota // channel operation
+	waitRoutines        // blocking SDK call that needs other routines to complete, e.g. Mutex.Lock
+	waitSDK             // blocking SDK call that completes by itself, e.g. time.Sleep
+)
+
+// routine represents an interpreted goroutine with its own call stack.
+// The VM holds the call stack of the running routine ; the others are stored here while not running.
+type routine struct {
+	id           int
+	callStack    stack[*stackFrame]
+	currentFrame *stackFrame
+	goPos        token.Pos // position of the go statement; NoPos for the main routine
+	goFunc       Func      // function that executed the go statement; nil for the main routine
+	parentId     int       // id of the routine that executed the go statement
+	steps        int       // number of steps taken since the routine was scheduled
+	// non-nil if the routine is waiting for one of these channel operations, or a blocking SDK call, to complete ;
+	// empty for a select without cases
+	wait       []reflect.SelectCase
+	waitReason string    // as reported in a goroutine dump, e.g. "chan receive"
+	waitPos    token.Pos // position of the step that made the routine wait
+	waitKind   int
+	// called with the outcome of the wait when the routine is running again
+	onWake func(vm *VM, chosen int, recv reflect.Value, recvOK bool)
+	// set when the wait has completed but the routine is not yet running
+	resume func(vm *VM)
+}
+
+func (r *routine) isWaiting() bool { return r.wait != nil }
+
+// isDone returns true if the routine has no more steps to take and is not waiting for anything.
+func (r *routine) isDone(step Step) bool {
+	return step == nil && r.wait == nil && r.resume == nil
+}
+
+func (r *routine) String() string {
+	return fmt.Sprintf("routine(%d)", r.id)
+}
+
+// startRoutine creates a new routine that will take the call step with the values on its operand stack.
+func (vm *VM) startRoutine(goPos token.Pos, env Env, call Step, values []reflect.Value) {
+	vm.ensureMainRoutine()
+	current := vm.routine
+	// save the spawning routine
+	current.callStack, current.currentFrame = vm.callStack, vm.currentFrame
+
+	vm.routineIdSeq++
+	r := &routine{id: vm.routineIdSeq, goPos: goPos, goFunc: vm.currentFrame.callee, parentId: current.id}
+	vm.routines = append(vm.routines, r)
+	if vm.race != nil {
+		vm.race.started(r, goPos)
+	}
+
+	// build the first frame of the new routine
+	vm.callStack = make(stack[*stackFrame], 0, 8)
+	vm.currentFrame = nil
+	vm.pushNewFrame(nil)
+	// function literals resolve their free variables from the spawning environment
+	env.markShared()
+	vm.currentFrame.env = env
+	vm.pushOperands(values...)
+	vm.currentFrame.step = call
+	r.callStack, r.currentFrame = vm.callStack, vm.currentFrame
+
+	// restore the spawning routine
+	vm.callStack, vm.currentFrame = current.callStack, current.currentFrame
+}
+
+// ensureMainRoutine registers the running call stack as the main routine.
+// Routines are only tracked after the first go statement or blocking operation.
+func (vm *VM) ensureMainRoutine() {
+	if vm.routine != nil {
+		return
+	}
+	vm.routineIdSeq++
+	main := &routine{id: vm.routineIdSeq}
+	vm.routines = append(vm.routines, main)
+	vm.routine = main
+}
+
+// hasOtherRoutines returns true if there are routines other than the running one.
+func (vm *VM) hasOtherRoutines() bool {
+	return len(vm.routines) > 1
+}
+
+// park makes the running routine wait for one of the channel operations to complete.
+// The step that parks the routine is done ; onWake is called with the index of the operation that has completed.
+func (vm *VM) park(cases []reflect.SelectCase, reason string, onWake func(vm *VM, chosen int, recv reflect.Value, recvOK bool)) {
+	vm.ensureMainRoutine()
+	r := vm.routine
+	if cases == nil {
+		// waits forever
+		cases = []reflect.SelectCase{}
+	}
+	r.wait = cases
+	r.waitReason = reason
+	r.waitPos = vm.currentFrame.step.pos()
+	r.waitKind = waitChannel
+	r.onWake = onWake
+}
+
+// schedule selects the routine that takes the next step.
+// It blocks if all routines are waiting and returns an error if none of them can ever continue.
+func (vm *VM) schedule() error {
+	if vm.scheduler != nil {
+		return vm.scheduler.schedule(vm)
+	}
+	for {
+		current := vm.routine
+		if current.isDone(vm.currentFrame.step) {
+			if current == vm.routines[0] {
+				// main is done ; other routines are abandoned
+				return nil
+			}
+			vm.popFrame()
+			vm.removeRoutine(current)
+			vm.load(vm.routines[0])
+			continue
+		}
+		if focus := vm.focus; focus != nil && focus != current && vm.canRun(focus) {
+			vm.switchTo(focus)
+			current = focus
+		}
+		if current.isWaiting() || (current.steps >= routineQuantum && current != vm.focus) {
+			next := vm.nextRunnable(current)
+			if next == nil {
+				if !vm.isDeadlocked() {
+					vm.awaitAny(0)
+					continue
+				}
+				// a blocking SDK call may have completed without its result being received yet
+				if !vm.awaitAny(deadlockGrace) {
+					return vm.deadlockError()
+				}
+				continue
+			}
+			vm.switchTo(next)
+		}
+		if running := vm.routine; running.resume != nil {
+			resume := running.resume
+			running.resume = nil
+			resume(vm)
+			// resuming can make the routine done
+			continue
+		}
+		vm.routine.steps++
+		return nil
+	}
+}
+
+// nextRunnable returns the first routine after the given one, round-robin, that can take a step.
+// Waiting routines are polled to see whether their operation can complete.
+// Returns nil if all routines are waiting.
+func (vm *VM) nextRunnable(after *routine) *routine {
+	start := 0
+	for i, each := range vm.routines {
+		if each == after {
+			start = i + 1
+			break
+		}
+	}
+	for i := range vm.routines {
+		each := vm.routines[(start+i)%len(vm.routines)]
+		if vm.canRun(each) {
+			return each
+		}
+	}
+	return nil
+}
+
+// canRun returns true if the routine is not waiting or its wait can complete now.
+func (vm *VM) canRun(r *routine) bool {
+	if !r.isWaiting() {
+		return true
+	}
+	if chosen, recv, recvOK := vm.pollCases(r.wait); chosen >= 0 {
+		r.wakeUp(chosen, recv, recvOK)
+		return true
+	}
+	return vm.handOff(r)
+}
+
+// pollCases returns the index of a channel operation that has completed without blocking, or -1 if none could.
+// The operations are tried from a rotating start such that no case of a select is always preferred ;
+// the Go runtime chooses at random but that would make a seeded schedule not replayable.
+func (vm *VM) pollCases(cases []reflect.SelectCase) (chosen int, recv reflect.Value, recvOK bool) {
+	vm.selectTurn++
+	for i := range cases {
+		each := (vm.selectTurn + i) % len(cases)
+		if index, recv, recvOK := reflect.Select([]reflect.SelectCase{cases[each], {Dir: reflect.SelectDefault}}); index == 0 {
+			return each, recv, recvOK
+		}
+	}
+	return -1, reflect.Value{}, false
+}
+
+// handOff completes a wait of a routine with a matching wait of another routine on the same channel.
+// Waiting routines are not actually blocked on a channel so a sender and receiver must be paired by the VM.
+func (vm *VM) handOff(r *routine) bool {
+	for i, mine := range r.wait {
+		if !isChannelCase(mine) {
+			continue
+		}
+		for _, other := range vm.routines {
+			if other == r || !other.isWaiting() {
+				continue
+			}
+			for j, theirs := range other.wait {
+				if !isChannelCase(theirs) || theirs.Dir == mine.Dir || theirs.Chan.Pointer() != mine.Chan.Pointer() {
+					continue
+				}
+				if mine.Dir == reflect.SelectRecv {
+					if vm.race != nil {
+						vm.race.handedOff(other, r)
+					}
+					r.wakeUp(i, theirs.Send, true)
+					other.wakeUp(j, reflect.Value{}, false)
+				} else {
+					if vm.race != nil {
+						vm.race.handedOff(r, other)
+					}
+					other.wakeUp(j, mine.Send, true)
+					r.wakeUp(i, reflect.Value{}, false)
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isChannelCase returns true if the case is a send or receive on a non-nil channel.
+func isChannelCase(c reflect.SelectCase) bool {
+	return c.Dir != reflect.SelectDefault && c.Chan.IsValid() && !c.Chan.IsNil()
+}
+
+// awaitAny blocks until the operation of one of the waiting routines has completed.
+// If timeout is positive then it returns false if no operation completed within that duration.
+func (vm *VM) awaitAny(timeout time.Duration) bool {
+	// for each case, the waiting routine and the index of the case in its wait
+	waiting := make([]*routine, 0, len(vm.routines))
+	indices := make([]int, 0, len(vm.routines))
+	cases := make([]reflect.SelectCase, 0, len(vm.routines)+1)
+	for _, each := range vm.routines {
+		for i, c := range each.wait {
+			waiting = append(waiting, each)
+			indices = append(indices, i)
+			cases = append(cases, c)
+		}
+	}
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	}
+	chosen, recv, recvOK := reflect.Select(cases)
+	if chosen == len(waiting) {
+		return false
+	}
+	waiting[chosen].wakeUp(indices[chosen], recv, recvOK)
+	return true
+}
+
+// wakeUp ends the wait ; the outcome is passed to onWake when the routine is running again.
+func (r *routine) wakeUp(chosen int, recv reflect.Value, recvOK bool) {
+	r.wait = nil
+	onWake := r.onWake
+	r.onWake = nil
+	r.resume = func(vm *VM) {
+		if onWake != nil {
+			onWake(vm, chosen, recv, recvOK)
+		}
+	}
+}
+
+// switchTo saves the call stack of the running routine and makes the given routine the running one.
+func (vm *VM) switchTo(r *routine) {
+	current := vm.routine
+	current.callStack, current.currentFrame = vm.callStack, vm.currentFrame
+	vm.load(r)
+}
+
+// load makes the given routine the running one without saving the call stack of the running routine.
+func (vm *VM) load(r *routine) {
+	vm.callStack, vm.currentFrame = r.callStack, r.currentFrame
+	vm.routine = r
+	r.steps = 0
+}
+
+func (vm *VM) removeRoutine(r *routine) {
+	if vm.focus == r {
+		vm.focus = nil
+	}
+	for i, each := range vm.routines {
+		if each == r {
+			vm.routines = append(vm.routines[:i], vm.routines[i+1:]...)
+			return
+		}
+	}
+}
+
+// blockingResult is the outcome of a blocking SDK call made on a separate goroutine.
+type blockingResult struct {
+	results  []reflect.Value
+	panicked any
+}
+
+// callBlocking makes the call to a blocking SDK function on a separate goroutine
+// and parks the running routine until that call returns.
+func (vm *VM) callBlocking(fn reflect.Value, args []reflect.Value, reason string, kind int) {
+	done := make(chan blockingResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- blockingResult{panicked: r}
+			}
+		}()
+		done <- blockingResult{results: fn.Call(args)}
+	}()
+	vm.park([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)}}, reason, func(vm *VM, _ int, recv reflect.Value, _ bool) {
+		result := recv.Interface().(blockingResult)
+		if result.panicked != nil {
+			panic(result.panicked)
+		}
+		vm.pushOperands(result.results...)
+	})
+	vm.routine.waitKind = kind
+}
+
+// blockingFuncs holds the SDK functions that can block the calling goroutine, by code pointer.
+// These calls complete without the help of other routines.
+var blockingFuncs = map[uintptr]string{
+	reflect.ValueOf(time.Sleep).Pointer(): "sleep",
+}
+
+// blockingMethods holds the SDK methods that can block the calling goroutine, by receiver type and method name.
+// These calls need other routines to complete, e.g. by calling Unlock or Done.
+var blockingMethods = map[reflect.Type]map[string]string{
+	reflect.TypeFor[*sync.Mutex]():     {"Lock": "sync.Mutex.Lock"},
+	reflect.TypeFor[*sync.RWMutex]():   {"Lock": "sync.RWMutex.Lock", "RLock": "sync.RWMutex.RLock"},
+	reflect.TypeFor[*sync.WaitGroup](): {"Wait": "sync.WaitGroup.Wait"},
+	reflect.TypeFor[*sync.Cond]():      {"Wait": "sync.Cond.Wait"},
+}
+
+// blockingFuncReason returns the wait reason if the function is a blocking SDK function.
+func blockingFuncReason(fn reflect.Value) (string, bool) {
+	reason, ok := blockingFuncs[fn.Pointer()]
+	return reason, ok
+}
+
+// blockingMethodReason returns the wait reason if the method is a blocking SDK method.
+func blockingMethodReason(recvType reflect.Type, name string) (string, bool) {
+	reason, ok := blockingMethods[recvType][name]
+	return reason, ok
+}
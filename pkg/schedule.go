@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// VMOption configures a VM when it is created.
+type VMOption func(vm *VM)
+
+// WithSeed makes the VM run interpreted goroutines under a deterministic scheduler.
+// At Step boundaries, the scheduler uses the seed to decide which runnable routine takes the next steps.
+// The order is recorded and available from VM.Schedule.
+// Blocking SDK calls, such as time.Sleep and sync.Mutex.Lock, run on goroutines of the Go runtime ; when they complete
+// is not decided by the seed, so runs of a program with such calls can differ for the same seed.
+// Replaying the recorded schedule waits for these calls to complete and so repeats the order of the run.
+func WithSeed(seed uint64) VMOption {
+	return func(vm *VM) {
+		vm.scheduler = &seededScheduler{
+			rand:     rand.New(rand.NewPCG(seed, seed)),
+			recorded: Schedule{Seed: seed},
+		}
+	}
+}
+
+// WithReplay makes the VM run interpreted goroutines in the order of a schedule recorded by an earlier run.
+func WithReplay(s Schedule) VMOption {
+	return func(vm *VM) {
+		vm.scheduler = &seededScheduler{
+			replay:   s.Slices,
+			recorded: Schedule{Seed: s.Seed},
+		}
+	}
+}
+
+// Schedule is the order in which routines have taken steps during a run with a seeded scheduler.
+type Schedule struct {
+	Seed   uint64
+	Slices []ScheduleSlice
+}
+
+// ScheduleSlice is a number of consecutive steps taken by one routine.
+type ScheduleSlice struct {
+	Routine int // routine id ; the main routine is 1
+	Steps   int
+}
+
+// Schedule returns the recorded schedule if the VM was created WithSeed or WithReplay.
+func (vm *VM) Schedule() Schedule {
+	if vm.scheduler == nil {
+		return Schedule{}
+	}
+	s := vm.scheduler.recorded
+	s.Slices = append([]ScheduleSlice(nil), s.Slices...)
+	return s
+}
+
+// seededScheduler decides which routine runs next using a random source or a recorded schedule.
+type seededScheduler struct {
+	rand      *rand.Rand      // nil when replaying
+	replay    []ScheduleSlice // slices to replay
+	recorded  Schedule        // slices taken so far
+	remaining int             // steps left in the current slice
+}
+
+// schedule selects the routine that takes the next step, see VM.schedule.
+func (s *seededScheduler) schedule(vm *VM) error {
+	for {
+		current := vm.routine
+		if current.isDone(vm.currentFrame.step) {
+			if current == vm.routines[0] {
+				// main is done ; other routines are abandoned
+				return nil
+			}
+			vm.popFrame()
+			vm.removeRoutine(current)
+			vm.load(vm.routines[0])
+			s.remaining = 0
+			continue
+		}
+		// the debugger steps the focused routine, see DAPAccess.StepThread ; a replay then diverges
+		focused := vm.focus != nil && vm.canRun(vm.focus)
+		if focused && vm.focus != current {
+			vm.switchTo(vm.focus)
+			s.remaining = 0
+			s.recorded.Slices = append(s.recorded.Slices, ScheduleSlice{Routine: vm.focus.id})
+		} else if !focused && (current.isWaiting() || s.remaining == 0) {
+			next, steps, err := s.nextSlice(vm)
+			if err != nil {
+				return err
+			}
+			if next != current {
+				vm.switchTo(next)
+			}
+			s.remaining = steps
+			s.recorded.Slices = append(s.recorded.Slices, ScheduleSlice{Routine: next.id})
+		}
+		if running := vm.routine; running.resume != nil {
+			resume := running.resume
+			running.resume = nil
+			resume(vm)
+			continue
+		}
+		if !focused {
+			s.remaining--
+		}
+		s.recorded.Slices[len(s.recorded.Slices)-1].Steps++
+		return nil
+	}
+}
+
+// nextSlice returns the routine that runs next and the number of steps it may take.
+func (s *seededScheduler) nextSlice(vm *VM) (*routine, int, error) {
+	if s.rand == nil {
+		return s.nextReplayed(vm)
+	}
+	for {
+		runnable := s.pollRunnable(vm)
+		if len(runnable) > 0 {
+			return runnable[s.rand.IntN(len(runnable))], 1 + s.rand.IntN(routineQuantum), nil
+		}
+		if !vm.isDeadlocked() {
+			vm.awaitAny(0)
+			continue
+		}
+		if !vm.awaitAny(deadlockGrace) {
+			return nil, 0, vm.deadlockError()
+		}
+	}
+}
+
+// nextReplayed returns the routine and steps of the next recorded slice.
+// If that routine is still waiting then it waits for that wait only, see awaitReplayed.
+func (s *seededScheduler) nextReplayed(vm *VM) (*routine, int, error) {
+	index := len(s.recorded.Slices)
+	if index >= len(s.replay) {
+		return nil, 0, fmt.Errorf("schedule replay diverged: no slice recorded after %d slices", index)
+	}
+	slice := s.replay[index]
+	var next *routine
+	for _, each := range vm.routines {
+		if each.id == slice.Routine {
+			next = each
+			break
+		}
+	}
+	if next == nil {
+		return nil, 0, fmt.Errorf("schedule replay diverged: no routine %d for slice %d", slice.Routine, index)
+	}
+	s.pollRunnable(vm)
+	if next.isWaiting() {
+		if err := s.awaitReplayed(vm, next, index); err != nil {
+			return nil, 0, err
+		}
+	}
+	return next, slice.Steps, nil
+}
+
+// awaitReplayed waits for the wait of the routine of a recorded slice to complete.
+// A blocking SDK call or a channel operation with SDK code completes by itself and is waited for.
+// A call that needs other routines, such as sync.Mutex.Lock, may not have returned yet and is waited for shortly.
+// Otherwise the wait needs steps of other routines, which the recorded slice does not give, and the replay has diverged.
+func (s *seededScheduler) awaitReplayed(vm *VM, r *routine, index int) error {
+	cases := slices.Clone(r.wait)
+	switch {
+	case r.waitKind == waitSDK:
+	case r.waitKind == waitChannel && slices.ContainsFunc(r.wait, func(c reflect.SelectCase) bool {
+		return isChannelCase(c) && !vm.channels[c.Chan.Interface()]
+	}):
+	case r.waitKind == waitRoutines:
+		timer := time.NewTimer(deadlockGrace)
+		defer timer.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	default:
+		cases = nil
+	}
+	chosen, recv, recvOK := len(r.wait), reflect.Value{}, false
+	if cases != nil {
+		chosen, recv, recvOK = reflect.Select(cases)
+	}
+	if chosen >= len(r.wait) {
+		return fmt.Errorf("schedule replay diverged: routine %d is blocked on %s for slice %d", r.id, r.waitReason, index)
+	}
+	r.wakeUp(chosen, recv, recvOK)
+	return nil
+}
+
+// pollRunnable returns the routines that can take a step, in order of creation.
+// Waiting routines are woken up if their operation can complete.
+func (s *seededScheduler) pollRunnable(vm *VM) (runnable []*routine) {
+	for _, each := range vm.routines {
+		if vm.canRun(each) {
+			runnable = append(runnable, each)
+		}
+	}
+	return
+}
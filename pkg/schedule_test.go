@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const interleavingSource = `package main
+
+func count(name string, done chan bool) {
+	for i := 0; i < 3; i++ {
+		print(name)
+	}
+	done <- true
+}
+func main() {
+	done := make(chan bool, 2)
+	go count("a", done)
+	go count("b", done)
+	<-done
+	<-done
+}`
+
+func runScheduled(t *testing.T, source string, option VMOption) (string, Schedule) {
+	t.Helper()
+	vm := NewVM(buildPackage(t, source), option)
+	collectPrintOutput(vm)
+	vm.launch("main", nil)
+	for {
+		if err := vm.Next(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+	}
+	return vm.output.String(), vm.Schedule()
+}
+
+func TestSeededSchedulerIsDeterministic(t *testing.T) {
+	out1, s1 := runScheduled(t, interleavingSource, WithSeed(42))
+	out2, s2 := runScheduled(t, interleavingSource, WithSeed(42))
+	if out1 != out2 {
+		t.Errorf("got %q and %q", out1, out2)
+	}
+	if !slices.Equal(s1.Slices, s2.Slices) {
+		t.Errorf("got %v and %v", s1.Slices, s2.Slices)
+	}
+	if s1.Seed != 42 {
+		t.Errorf("got seed %d", s1.Seed)
+	}
+}
+
+func TestSeededSchedulerInterleaves(t *testing.T) {
+	outputs := map[string]bool{}
+	for seed := range uint64(20) {
+		out, _ := runScheduled(t, interleavingSource, WithSeed(seed))
+		outputs[out] = true
+	}
+	if len(outputs) < 2 {
+		t.Errorf("expected different interleavings, got %v", outputs)
+	}
+}
+
+func TestReplaySchedule(t *testing.T) {
+	for seed := range uint64(5) {
+		out, recorded := runScheduled(t, interleavingSource, WithSeed(seed))
+		replayedOut, replayed := runScheduled(t, interleavingSource, WithReplay(recorded))
+		if out != replayedOut {
+			t.Errorf("seed %d: got %q want %q", seed, replayedOut, out)
+		}
+		if !slices.Equal(recorded.Slices, replayed.Slices) {
+			t.Errorf("seed %d: got %v want %v", seed, replayed.Slices, recorded.Slices)
+		}
+	}
+}
+
+func TestReplayScheduleDiverged(t *testing.T) {
+	vm := NewVM(buildPackage(t, interleavingSource), WithReplay(Schedule{Slices: []ScheduleSlice{{Routine: 7, Steps: 1}}}))
+	collectPrintOutput(vm)
+	vm.launch("main", nil)
+	for {
+		err := vm.Next()
+		if err == io.EOF {
+			t.Fatal("expected error")
+		}
+		if err != nil {
+			break
+		}
+	}
+}
+
+func TestReplayScheduleBlocked(t *testing.T) {
+	// the goroutine that sends is never given a slice
+	replay := Schedule{}
+	for range 100 {
+		replay.Slices = append(replay.Slices, ScheduleSlice{Routine: 1, Steps: 1})
+	}
+	vm := NewVM(buildPackage(t, `package main
+
+func main() {
+	ch := make(chan int)
+	go func() { ch <- 1 }()
+	print(<-ch)
+}`), WithReplay(replay))
+	collectPrintOutput(vm)
+	vm.launch("main", nil)
+	for {
+		err := vm.Next()
+		if err == io.EOF {
+			t.Fatal("expected error")
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), "schedule replay diverged: routine 1 is blocked on chan receive") {
+				t.Errorf("unexpected error %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestSeededSchedulerHonorsFocus(t *testing.T) {
+	vm := NewVM(buildPackage(t, interleavingSource), WithSeed(3))
+	collectPrintOutput(vm)
+	vm.launch("main", nil)
+	for len(vm.routines) < 3 {
+		if err := vm.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	focus := vm.routines[2]
+	vm.focus = focus
+	for slices.Contains(vm.routines, focus) {
+		if err := vm.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if vm.routine != focus && slices.Contains(vm.routines, focus) {
+			t.Fatalf("routine %d took a step while %d is focused", vm.routine.id, focus.id)
+		}
+	}
+	if got := vm.output.String(); !strings.Contains(got, "bbb") {
+		t.Errorf("got %q", got)
+	}
+}
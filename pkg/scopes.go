@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-dap"
+)
+
+// The variables references of the scopes of environments are their depths ; those of the other scopes are far above.
+const (
+	operandsReference = 1<<20 + iota
+	heapReference
+	// first of the package scopes, one for each subpackage
+	subpackagesReference
+)
+
+// appendExtraScopes appends the scopes of the package variables of subpackages and, if InternalScopes is set,
+// of the operand stack of a frame and the heap of the VM.
+func (a *DAPAccess) appendExtraScopes(scopes []dap.Scope, frame *stackFrame) []dap.Scope {
+	for i, each := range a.subpackages() {
+		scopes = append(scopes, dap.Scope{
+			Name:               "package " + each.PkgPath,
+			VariablesReference: subpackagesReference + i,
+			Expensive:          true,
+		})
+	}
+	if !a.InternalScopes {
+		return scopes
+	}
+	return append(scopes,
+		dap.Scope{
+			Name:               "operands",
+			VariablesReference: operandsReference,
+			IndexedVariables:   len(frame.operands),
+		},
+		dap.Scope{
+			Name:               "heap",
+			VariablesReference: heapReference,
+			NamedVariables:     len(a.vm.heap.values),
+			Expensive:          true,
+		})
+}
+
+// extraVariables returns the variables of a scope added by appendExtraScopes ; false if the reference is not of such scope.
+func (a *DAPAccess) extraVariables(frame *stackFrame, reference int) (vars []dap.Variable, ok bool) {
+	switch {
+	case reference == operandsReference:
+		// bottom first ; the last one is popped first
+		for i, each := range frame.operands {
+			vars = append(vars, dap.Variable{Name: fmt.Sprint(i), Value: stringOf(each), Type: typeNameOf(each)})
+		}
+		return vars, true
+	case reference == heapReference:
+		addresses := make([]uintptr, 0, len(a.vm.heap.values))
+		for each := range a.vm.heap.values {
+			addresses = append(addresses, each)
+		}
+		slices.Sort(addresses)
+		for _, each := range addresses {
+			v := a.vm.heap.values[each]
+			// named as the HeapPointer to the value
+			vars = append(vars, dap.Variable{Name: fmt.Sprintf("0x%x", each), Value: stringOf(v), Type: typeNameOf(v)})
+		}
+		return vars, true
+	case reference >= subpackagesReference:
+		subpackages := a.subpackages()
+		i := reference - subpackagesReference
+		if i >= len(subpackages) {
+			return nil, true
+		}
+		vars = subpackages[i].env.appendVariables(vars)
+		for j := range vars {
+			vars[j].VariablesReference = reference
+		}
+		slices.SortFunc(vars, func(s1, s2 dap.Variable) int { return cmp.Compare(s1.Name, s2.Name) })
+		return vars, true
+	}
+	return nil, false
+}
+
+// subpackages returns the interpreted packages other than the main package, ordered by path.
+// Of a package that is built for each package that imports it, the one nearest to the main package is used.
+func (a *DAPAccess) subpackages() (list []*Package) {
+	seen := map[string]bool{a.vm.pkg.PkgPath: true}
+	for _, each := range a.vm.packages() {
+		if !seen[each.PkgPath] {
+			seen[each.PkgPath] = true
+			list = append(list, each)
+		}
+	}
+	slices.SortFunc(list, func(p1, p2 *Package) int { return cmp.Compare(p1.PkgPath, p2.PkgPath) })
+	return
+}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+// scopeNamed returns the reference of the scope with a name ; 0 if missing.
+func scopeNamed(xs *DAPAccess, name string) int {
+	for _, each := range xs.Scopes(dap.ScopesArguments{}) {
+		if each.Name == name {
+			return each.VariablesReference
+		}
+	}
+	return 0
+}
+
+func TestInternalScopesAreOptional(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{})
+	if scopeNamed(xs, "operands") != 0 || scopeNamed(xs, "heap") != 0 {
+		t.Error("unexpected internal scopes")
+	}
+}
+
+func TestOperandsScope(t *testing.T) {
+	xs := continueToBreakpoint(t, dap.SourceBreakpoint{Condition: "i == 4"})
+	xs.InternalScopes = true
+	ref := scopeNamed(xs, "operands")
+	if ref == 0 {
+		t.Fatal("missing operands scope")
+	}
+	if vars := xs.Variables(dap.VariablesArguments{VariablesReference: ref}); len(vars) != 0 {
+		t.Fatalf("expected no operands at the start of a statement, got %v", vars)
+	}
+	// the first step of the statement pushes the value of i
+	if err := xs.StepThread(1); err != nil {
+		t.Fatal(err)
+	}
+	vars := xs.Variables(dap.VariablesArguments{VariablesReference: ref})
+	if len(vars) != 1 {
+		t.Fatalf("got %v", vars)
+	}
+	if got, want := vars[0].Value, "4"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestHeapScope(t *testing.T) {
+	xs := continueToBreakpointIn(t, counterSource, 14)
+	xs.InternalScopes = true
+	ref := scopeNamed(xs, "heap")
+	if ref == 0 {
+		t.Fatal("missing heap scope")
+	}
+	vars := xs.Variables(dap.VariablesArguments{VariablesReference: ref})
+	if len(vars) != 1 {
+		t.Fatalf("got %v", vars)
+	}
+	// named by the address of the pointer c
+	if got, want := vars[0].Name, "0x1"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestSubpackageScopes(t *testing.T) {
+	cwd, _ := os.Getwd()
+	loc := path.Join(cwd, "../examples/nestedpkgs")
+	gopkg, err := LoadPackage(loc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(loc)
+	defer os.Chdir(cwd)
+	pkg, err := BuildPackage(gopkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs := NewDAPAccess(NewVM(pkg))
+	xs.Launch("main", nil)
+	// the packages are initialized before main is called
+	for f := xs.vm.currentFrame; f.callee == nil || xs.vm.funcName(f.callee) != "main.main"; f = xs.vm.currentFrame {
+		if err := xs.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := map[string]int{}
+	for _, each := range xs.Scopes(dap.ScopesArguments{}) {
+		names[each.Name]++
+	}
+	for _, each := range []string{"package nestedpkgs/pkga", "package nestedpkgs/pkgb", "package nestedpkgs/pkgb/pkgc"} {
+		if names[each] != 1 {
+			t.Errorf("got %d scopes %s", names[each], each)
+		}
+	}
+	vars := xs.Variables(dap.VariablesArguments{VariablesReference: scopeNamed(xs, "package nestedpkgs/pkgb/pkgc")})
+	values := map[string]string{}
+	for _, each := range vars {
+		values[each.Name] = each.Value
+	}
+	if got, want := values["C"], "C"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// imported packages are not variables
+	if _, ok := values["pkgb"]; ok {
+		t.Error("unexpected package pkgb")
+	}
+}
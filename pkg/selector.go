@@ -33,6 +33,9 @@ func (s SelectorExpr) assign(vm *VM, val reflect.Value) {
 		// can we assign directly to the field?
 		fa, ok := recv.Interface().(FieldAssignable)
 		if ok {
+			vm.raceField(recv, s.selector.name, true)
+			vm.watchField(recv, s.selector.name, val)
+			vm.recordField(recv, s.selector.name)
 			fa.fieldAssign(s.selector.name, val)
 			return
 		}
@@ -58,6 +61,9 @@ func (s SelectorExpr) assign(vm *VM, val reflect.Value) {
 		if !sel.CanSet() {
 			vm.fatalf("field %s is not settable for receiver: %v (%T)", s.selector.name, recv.Interface(), recv.Interface())
 		}
+		vm.raceField(recv, s.selector.name, true)
+		vm.watchField(recv, s.selector.name, val)
+		vm.recordSettable(sel)
 		sel.Set(val)
 		return
 	}
@@ -75,11 +81,13 @@ func (s SelectorExpr) eval(vm *VM) {
 	rec, ok := recv.Interface().(CanSelect)
 	if ok {
 		// can be field or method
-		sel := rec.selectByName(s.selector.name)
+		sel := vm.selectStd(rec, s.selector.name, rec.selectByName(s.selector.name))
 		// check for method
 		if _, ok := sel.Interface().(*FuncDecl); ok {
 			// method value so push receiver as first argument
 			vm.pushOperand(recv)
+		} else {
+			vm.raceField(recv, s.selector.name, false)
 		}
 		vm.pushOperand(sel)
 		return
@@ -104,8 +112,22 @@ func (s SelectorExpr) eval(vm *VM) {
 		}
 	}
 
+	if t, ok := recv.Interface().(*testingT); ok && s.selector.name == "Run" {
+		// the subtest function is interpreted
+		vm.pushOperand(reflect.ValueOf(subtestRun{t: t}))
+		return
+	}
+
 	meth := recv.MethodByName(s.selector.name)
 	if meth.IsValid() {
+		_, blocking := blockingMethodReason(recv.Type(), s.selector.name)
+		if blocking || (vm.race != nil && isSyncMethod(recv.Type(), s.selector.name)) {
+			// push receiver and method so the call can be recognized as blocking or synchronizing
+			rm, _ := recv.Type().MethodByName(s.selector.name)
+			vm.pushOperand(recv)
+			vm.pushOperand(reflect.ValueOf(rm))
+			return
+		}
 		vm.pushOperand(meth)
 		return
 	}
@@ -161,3 +183,13 @@ func (s SelectorExpr) pos() token.Pos { return s.selector.namePos }
 func (s SelectorExpr) String() string {
 	return fmt.Sprintf("SelectorExpr(%v, %v)", s.x, s.selector.name)
 }
+
+// raceField checks the access of a field of an interpreted struct value if data races are detected.
+func (vm *VM) raceField(recv reflect.Value, name string, write bool) {
+	if vm.race == nil {
+		return
+	}
+	if sv, ok := recv.Interface().(StructValue); ok {
+		vm.race.access(raceKey{owner: sv.fields, name: name}, write)
+	}
+}
@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"weak"
+
+	"github.com/google/go-dap"
+	"golang.org/x/tools/go/packages"
+)
+
+// parsedSources holds the contents of the files of packages parsed by ParseSource, by file name, until
+// the packages are built. Their files are removed from disk after parsing. An entry is removed when its
+// package is built, whether that succeeds or not, or when the package is garbage collected unbuilt.
+var (
+	parsedSourcesMutex sync.Mutex
+	parsedSources      = map[weak.Pointer[packages.Package]]map[string][]byte{}
+)
+
+// keepParsedSources holds the contents of the files of a package parsed by ParseSource until it is built.
+func keepParsedSources(goPkg *packages.Package, sources map[string][]byte) {
+	key := weak.Make(goPkg)
+	parsedSourcesMutex.Lock()
+	parsedSources[key] = sources
+	parsedSourcesMutex.Unlock()
+	runtime.AddCleanup(goPkg, func(key weak.Pointer[packages.Package]) {
+		parsedSourcesMutex.Lock()
+		delete(parsedSources, key)
+		parsedSourcesMutex.Unlock()
+	}, key)
+}
+
+// takeParsedSources returns and forgets the contents of the files of a package parsed by ParseSource ; nil if not parsed.
+func takeParsedSources(goPkg *packages.Package) map[string][]byte {
+	key := weak.Make(goPkg)
+	parsedSourcesMutex.Lock()
+	defer parsedSourcesMutex.Unlock()
+	sources := parsedSources[key]
+	delete(parsedSources, key)
+	return sources
+}
+
+// sourceOf returns the content of a file of the package, from memory if it was parsed from source or else from disk.
+func (p *Package) sourceOf(file string) ([]byte, error) {
+	if content, ok := p.sources[file]; ok {
+		return content, nil
+	}
+	if !slices.Contains(p.GoFiles, file) {
+		return nil, fmt.Errorf("%s is not a file of package %s", file, p.PkgPath)
+	}
+	return os.ReadFile(file)
+}
+
+// packages returns the main package and its interpreted subpackages, including those imported by subpackages.
+func (vm *VM) packages() []*Package {
+	list := []*Package{vm.pkg}
+	seen := map[*Package]bool{vm.pkg: true}
+	for i := 0; i < len(list); i++ {
+		for _, each := range list[i].env.packages {
+			if !seen[each] {
+				seen[each] = true
+				list = append(list, each)
+			}
+		}
+	}
+	return list
+}
+
+// packageOfFile returns the package of an interpreted file ; nil if none.
+func (vm *VM) packageOfFile(file string) *Package {
+	for _, each := range vm.packages() {
+		if slices.Contains(each.GoFiles, file) {
+			return each
+		}
+	}
+	return nil
+}
+
+// inMemoryFiles returns the sorted names of the files that are only in memory.
+// A file is referred to by its index plus one, as the sourceReference of the DAP.
+func (vm *VM) inMemoryFiles() (files []string) {
+	for _, each := range vm.packages() {
+		for file := range each.sources {
+			files = append(files, file)
+		}
+	}
+	slices.Sort(files)
+	return
+}
+
+// sourceOf returns the DAP source of an interpreted file. A file that is only in memory has a source reference.
+func (vm *VM) sourceOf(file string) *dap.Source {
+	source := &dap.Source{Name: filepath.Base(file), Path: file}
+	if i := slices.Index(vm.inMemoryFiles(), file); i != -1 {
+		source.SourceReference = i + 1
+		source.Origin = "parsed from source"
+	}
+	return source
+}
+
+// LoadedSources returns the interpreted files of the program, including those of subpackages, ordered by path.
+func (a *DAPAccess) LoadedSources() (sources []dap.Source) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var files []string
+	for _, each := range a.vm.packages() {
+		files = append(files, each.GoFiles...)
+	}
+	slices.Sort(files)
+	for _, each := range slices.Compact(files) {
+		sources = append(sources, *a.vm.sourceOf(each))
+	}
+	return
+}
+
+// SourcePath returns the file name of a source reference ; empty if unknown.
+func (a *DAPAccess) SourcePath(sourceReference int) string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	files := a.vm.inMemoryFiles()
+	if sourceReference < 1 || sourceReference > len(files) {
+		return ""
+	}
+	return files[sourceReference-1]
+}
+
+// SourceContent returns the content of an interpreted file, given by source reference if positive or else by path.
+func (a *DAPAccess) SourceContent(sourceReference int, path string) (string, error) {
+	if sourceReference > 0 {
+		if path = a.SourcePath(sourceReference); path == "" {
+			return "", fmt.Errorf("unknown source reference %d", sourceReference)
+		}
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	p := a.vm.packageOfFile(path)
+	if p == nil {
+		return "", fmt.Errorf("%s is not a file of the program", path)
+	}
+	content, err := p.sourceOf(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
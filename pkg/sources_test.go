@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+	"weak"
+
+	"github.com/google/go-dap"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestSourceOfParsedProgram(t *testing.T) {
+	xs := continueToBreakpointIn(t, failSource, 8)
+	sources := xs.LoadedSources()
+	if got, want := len(sources), 1; got != want {
+		t.Fatalf("got %d want %d", got, want)
+	}
+	source := sources[0]
+	if got, want := source.SourceReference, 1; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if _, err := os.Stat(source.Path); !os.IsNotExist(err) {
+		t.Errorf("expected no file %s", source.Path)
+	}
+	content, err := xs.SourceContent(source.SourceReference, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := content, failSource; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	frames := xs.StackFrames(dap.StackTraceArguments{ThreadId: 1})
+	if got, want := frames[0].Source.SourceReference, 1; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+	if got, want := xs.SourcePath(1), source.Path; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if _, err := xs.SourceContent(2, ""); err == nil {
+		t.Error("expected error for unknown reference")
+	}
+}
+
+func TestLoadedSourcesOfSubpackages(t *testing.T) {
+	cwd, _ := os.Getwd()
+	loc := path.Join(cwd, "../examples/nestedpkgs")
+	gopkg, err := LoadPackage(loc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// imported packages are located by module, not by working directory
+	pkg, err := BuildPackage(gopkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs := NewDAPAccess(NewVM(pkg))
+	names := map[string]bool{}
+	for _, each := range xs.LoadedSources() {
+		if each.SourceReference != 0 {
+			t.Errorf("expected no reference for %s", each.Path)
+		}
+		rel, _ := filepath.Rel(loc, each.Path)
+		names[rel] = true
+	}
+	for _, each := range []string{"main.go", "pkga/a.go", "pkgb/b.go", "pkgb/pkgc/c.go"} {
+		if !names[each] {
+			t.Errorf("missing %s in %v", each, names)
+		}
+	}
+	content, err := xs.SourceContent(0, filepath.Join(loc, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(loc, "main.go"))
+	if content != string(data) {
+		t.Error("expected content of main.go")
+	}
+	if _, err := xs.SourceContent(0, filepath.Join(loc, "go.mod")); err == nil {
+		t.Error("expected error for a file that is not interpreted")
+	}
+}
+
+// hasParsedSources returns whether the contents of the files of a parsed package are held.
+func hasParsedSources(key weak.Pointer[packages.Package]) bool {
+	parsedSourcesMutex.Lock()
+	defer parsedSourcesMutex.Unlock()
+	_, ok := parsedSources[key]
+	return ok
+}
+
+func TestParsedSourcesOfUnbuiltPackage(t *testing.T) {
+	goPkg, err := ParseSource(failSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := weak.Make(goPkg)
+	if !hasParsedSources(key) {
+		t.Fatal("expected sources until built")
+	}
+	goPkg = nil
+	// the cleanup runs after the package is collected
+	for range 100 {
+		runtime.GC()
+		if !hasParsedSources(key) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected no sources of a collected package")
+}
+
+func TestParsedSourcesOfBuiltPackage(t *testing.T) {
+	goPkg, err := ParseSource(failSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildPackage(goPkg); err != nil {
+		t.Fatal(err)
+	}
+	if hasParsedSources(weak.Make(goPkg)) {
+		t.Error("expected no sources after build")
+	}
+}
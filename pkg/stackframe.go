@@ -17,6 +17,11 @@ type stackFrame struct {
 	defers   []funcInvocation
 	step     Step // for using the VM to debug a function
 	returnTo Step // the step to return to after this function finishes, or nil if this is the top-level frame
+	line     int  // source line of the last step taken ; only maintained while debugging with breakpoints
+	// the call of callee, to restart the frame
+	args    []reflect.Value // arguments as passed
+	recv    reflect.Value   // receiver of a method
+	funcEnv Env             // environment in which the parameters are set
 }
 
 // reset is called before putting the frame back into the pool.
@@ -28,6 +33,10 @@ func (f *stackFrame) reset() {
 	f.defers = f.defers[:0]
 	f.step = nil
 	f.returnTo = nil
+	f.line = 0
+	f.args = nil
+	f.recv = reflect.Value{}
+	f.funcEnv = nil
 }
 
 // push adds a value onto the operand stack.
@@ -46,6 +55,7 @@ func (f *stackFrame) pop() reflect.Value {
 func (f *stackFrame) pushEnv() {
 	child := envPool.Get().(*Environment)
 	child.parentEnv = f.env // can be nil
+	child.journal = journalOf(f.env)
 	f.env = child
 }
 
@@ -54,8 +64,8 @@ func (f *stackFrame) popEnv() {
 	child := f.env.(*Environment)
 	f.env = child.parent() // can become nil
 
-	// cannot recycle env if heappointer is referencing it
-	if !child.isShared {
+	// cannot recycle env if heappointer is referencing it or a recorded state refers to it
+	if !child.isShared && child.journal == nil {
 		child.parentEnv = nil
 		clear(child.values)
 		envPool.Put(child)
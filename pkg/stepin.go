@@ -0,0 +1,223 @@
+package pkg
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"github.com/google/go-dap"
+)
+
+// stepInTarget is a call on the line of a frame into which the execution of the frame can step.
+type stepInTarget struct {
+	frameId int
+	step    Step // the step that takes the call
+	label   string
+	start   token.Position
+	end     token.Position
+}
+
+// stepStart is where stepping a goroutine started.
+type stepStart struct {
+	frameId int
+	depth   int // number of frames of the goroutine
+	line    int
+}
+
+// StepLine advances the goroutine with the given thread id until its next step is on another line or in another
+// frame, such as that of a called function. Steps without a position are taken as part of the line.
+func (a *DAPAccess) StepLine(threadId int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.stepLine(threadId)
+}
+
+func (a *DAPAccess) stepLine(threadId int) error {
+	return a.stepUntil(threadId, func(frame *stackFrame, from stepStart) bool {
+		return frame.id != from.frameId || a.isOtherLine(frame, from)
+	})
+}
+
+// StepOver advances the goroutine with the given thread id until its next step is on another line of the same frame
+// or in the frame of the caller. Calls on the line run to their end unless a breakpoint in them is hit ;
+// the reason to stop is then that of the breakpoint, otherwise "step".
+func (a *DAPAccess) StepOver(threadId int) (reason string, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	reason = "step"
+	err = a.stepUntil(threadId, func(frame *stackFrame, from stepStart) bool {
+		if len(a.vm.callStack) > from.depth {
+			if r := a.breakpointReason(); r != "" {
+				reason = r
+				return true
+			}
+			return false
+		}
+		return frame.id != from.frameId || a.isOtherLine(frame, from)
+	})
+	return
+}
+
+// StepIn advances the goroutine with the given thread id into the call of a target of the last StepInTargets request.
+// Calls before it run to their end. Without a target, or if the target is not reached on the line, it is StepLine.
+func (a *DAPAccess) StepIn(threadId int, targetId int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if targetId < 1 || targetId > len(a.stepInTargets) {
+		return a.stepLine(threadId)
+	}
+	target := a.stepInTargets[targetId-1]
+	reached := func(frame *stackFrame) bool {
+		return frame.id == target.frameId && frame.step == target.step
+	}
+	if callStack := a.callStackOf(a.routineOf(threadId)); len(callStack) == 0 || !reached(callStack.top()) {
+		err := a.stepUntil(threadId, func(frame *stackFrame, from stepStart) bool {
+			if len(a.vm.callStack) > from.depth {
+				return false
+			}
+			return reached(frame) || frame.id != from.frameId || a.isOtherLine(frame, from)
+		})
+		if err != nil || a.vm.currentFrame == nil || !reached(a.vm.currentFrame) {
+			return err
+		}
+	}
+	return a.stepLine(threadId)
+}
+
+// stepUntil advances the goroutine with the given thread id until stop returns true for the frame of its next step.
+// It returns early if the goroutine has ended.
+func (a *DAPAccess) stepUntil(threadId int, stop func(frame *stackFrame, from stepStart) bool) error {
+	target := a.routineOf(threadId)
+	callStack := a.callStackOf(target)
+	if len(callStack) == 0 {
+		return a.stepThread(threadId)
+	}
+	top := callStack.top()
+	from := stepStart{frameId: top.id, depth: len(callStack), line: a.vm.positionOf(top, top.step).Line}
+	for {
+		if err := a.stepThread(threadId); err != nil {
+			return err
+		}
+		if target != nil && !slices.Contains(a.vm.routines, target) {
+			return nil
+		}
+		frame := a.vm.currentFrame
+		if frame == nil || stop(frame, from) {
+			return nil
+		}
+	}
+}
+
+// isOtherLine returns whether the next step of a frame has a position on another line than where stepping started.
+func (a *DAPAccess) isOtherLine(frame *stackFrame, from stepStart) bool {
+	p := a.vm.positionOf(frame, frame.step)
+	return p.IsValid() && p.Line != from.line
+}
+
+// StepInTargets returns the calls of interpreted functions on the line of the next step of a frame, in the order in
+// which they are made. Calls that are already made are left out.
+func (a *DAPAccess) StepInTargets(frameId int) (targets []dap.StepInTarget) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stepInTargets = a.vm.stepInTargets(a.frameOf(frameId))
+	for i, each := range a.stepInTargets {
+		targets = append(targets, dap.StepInTarget{
+			Id:        i + 1,
+			Label:     each.label,
+			Line:      each.start.Line,
+			Column:    each.start.Column,
+			EndLine:   each.end.Line,
+			EndColumn: each.end.Column,
+		})
+	}
+	return
+}
+
+func (vm *VM) stepInTargets(frame *stackFrame) (targets []stepInTarget) {
+	if frame == nil || frame.callee == nil || frame.step == nil {
+		return nil
+	}
+	at := vm.positionOf(frame, frame.step)
+	if !at.IsValid() {
+		return nil
+	}
+	calls := vm.callsOn(at.Filename, at.Line)
+	for _, each := range vm.instructionsOf(frame.callee) {
+		es, ok := each.(*evaluableStep)
+		if !ok || each.ID() < frame.step.ID() {
+			continue
+		}
+		ce, ok := es.Evaluable.(CallExpr)
+		if !ok {
+			continue
+		}
+		if p := vm.positionOf(frame, each); p.Filename != at.Filename || p.Line != at.Line {
+			continue
+		}
+		if call, ok := calls[vm.fileSetOf(frame).Position(ce.lparenPos)]; ok {
+			call.frameId = frame.id
+			call.step = each
+			targets = append(targets, call)
+		}
+	}
+	return
+}
+
+// callsOn returns the calls of interpreted functions on a line of a source file, by the position of their left
+// parenthesis. Calls of builtin functions, conversions and calls of functions of packages that are not interpreted
+// are left out ; calls of function values and interface methods may be interpreted.
+func (vm *VM) callsOn(file string, line int) map[token.Position]stepInTarget {
+	interpreted := map[string]bool{}
+	for _, each := range vm.packages() {
+		interpreted[each.PkgPath] = true
+	}
+	calls := map[token.Position]stepInTarget{}
+	for _, pkg := range vm.packages() {
+		for _, syntax := range pkg.Syntax {
+			if pkg.Fset.Position(syntax.Pos()).Filename != file {
+				continue
+			}
+			ast.Inspect(syntax, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || pkg.Fset.Position(call.Lparen).Line != line || !isInterpretedCall(pkg.TypesInfo, call, interpreted) {
+					return true
+				}
+				calls[pkg.Fset.Position(call.Lparen)] = stepInTarget{
+					label: types.ExprString(call.Fun),
+					start: pkg.Fset.Position(call.Fun.Pos()),
+					end:   pkg.Fset.Position(call.End()),
+				}
+				return true
+			})
+		}
+	}
+	return calls
+}
+
+func isInterpretedCall(info *types.Info, call *ast.CallExpr, interpreted map[string]bool) bool {
+	if info == nil {
+		return true
+	}
+	if tv := info.Types[call.Fun]; tv.IsType() || tv.IsBuiltin() {
+		return false
+	}
+	var name *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		name = fun
+	case *ast.SelectorExpr:
+		name = fun.Sel
+	}
+	if name == nil {
+		return true
+	}
+	fn, ok := info.Uses[name].(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return true
+	}
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil && types.IsInterface(recv.Type()) {
+		return true
+	}
+	return interpreted[fn.Pkg().Path()]
+}
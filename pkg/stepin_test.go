@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-dap"
+)
+
+const nestedCallSource = `package main
+
+import "strings"
+
+func g(x int) int {
+	return x + 1
+}
+func f(x int) int {
+	return x * 2
+}
+func main() {
+	x := f(g(len(strings.Repeat("a", 2))))
+	print(x)
+}`
+
+func TestStepInTargets(t *testing.T) {
+	xs := continueToBreakpointIn(t, nestedCallSource, 12)
+	targets := xs.StepInTargets(0)
+	if got, want := len(targets), 2; got != want {
+		t.Fatalf("got %d want %d: %v", got, want, targets)
+	}
+	// in the order of the calls
+	for i, want := range []string{"g", "f"} {
+		if got := targets[i].Label; got != want {
+			t.Errorf("got %q want %q", got, want)
+		}
+		if got := targets[i].Line; got != 12 {
+			t.Errorf("got %d want 12", got)
+		}
+	}
+	if got, want := targets[1].Column, 7; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestStepInTarget(t *testing.T) {
+	xs := continueToBreakpointIn(t, nestedCallSource, 12)
+	xs.StepInTargets(0)
+	if err := xs.StepIn(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "main.f"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	// g has returned
+	if got, want := evalString(t, xs, "x"), "3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestStepInWithoutTarget(t *testing.T) {
+	xs := continueToBreakpointIn(t, nestedCallSource, 12)
+	if err := xs.StepIn(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "main.g"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestStepOver(t *testing.T) {
+	xs := continueToBreakpointIn(t, nestedCallSource, 12)
+	reason, err := xs.StepOver(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "step"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	frame := xs.vm.currentFrame
+	if got, want := xs.vm.positionOf(frame, frame.step).Line, 13; got != want {
+		t.Errorf("got %d want %d", got, want)
+	}
+}
+
+func TestStepOverStopsAtBreakpointInCall(t *testing.T) {
+	xs := continueToBreakpointIn(t, nestedCallSource, 12)
+	file := xs.vm.pkg.GoFiles[0]
+	bp, _ := NewBreakpoint(file, dap.SourceBreakpoint{Line: 9})
+	xs.SetBreakpoints(file, []*Breakpoint{bp})
+	reason, err := xs.StepOver(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reason, "breakpoint"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := xs.vm.funcName(xs.vm.currentFrame.callee), "main.f"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestBreakpointLocations(t *testing.T) {
+	pkg := buildPackage(t, nestedCallSource)
+	xs := NewDAPAccess(NewVM(pkg))
+	var lines []int
+	for _, each := range xs.BreakpointLocations(pkg.GoFiles[0], 1, 14) {
+		lines = append(lines, each.Line)
+	}
+	if got, want := lines, []int{6, 9, 12, 13}; !slices.Equal(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	locations := xs.BreakpointLocations(pkg.GoFiles[0], 12, 0)
+	if len(locations) != 1 || locations[0].Column != 2 {
+		t.Errorf("unexpected locations %v", locations)
+	}
+}
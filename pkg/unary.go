@@ -90,11 +90,30 @@ func (u UnaryExpr) eval(vm *VM) {
 	case reflect.Chan:
 		switch u.op {
 		case token.ARROW: // receive
-			val, ok := v.Recv()
-			if !ok {
-				vm.pushOperand(reflect.Zero(v.Type()))
-			} else {
+			val, ok := v.TryRecv()
+			if ok || val.IsValid() {
+				if vm.race != nil {
+					vm.race.acquire(syncObject(v))
+				}
+			}
+			if ok {
 				vm.pushOperand(val)
+				return
+			}
+			if val.IsValid() {
+				// closed
+				vm.pushOperand(reflect.Zero(v.Type().Elem()))
+				return
+			}
+			// let other routines make progress until a value can be received
+			vm.park([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: v}}, "chan receive", func(vm *VM, _ int, recv reflect.Value, recvOK bool) {
+				if !recvOK {
+					recv = reflect.Zero(v.Type().Elem())
+				}
+				vm.pushOperand(recv)
+			})
+			if vm.race != nil {
+				vm.race.acquireOnWake(syncObject(v))
 			}
 		default:
 			vm.fatalf("missing unary operation on chan:%s", u.op.String())
@@ -76,6 +76,10 @@ func (cv *ConstVar) eval(vm *VM) {
 		// zero value
 		typ := makeType(vm, cv.typ)
 		zv := reflect.Zero(typ)
+		if typ.Kind() == reflect.Struct {
+			// addressable such that methods with a pointer receiver, e.g. sync.WaitGroup.Add, change the variable and not a copy
+			zv = reflect.New(typ).Elem()
+		}
 		vm.currentEnv().valueSet(cv.ident.name, zv)
 	}
 	cv.isResolved = true
@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -38,6 +39,46 @@ func main() {
 }`, "9455")
 }
 
+func TestDeclarationOrderWithSideEffects(t *testing.T) {
+	testMain(t, `package main
+
+var a = g(b)
+var b = f()
+var c int
+
+func f() int {
+	print("f")
+	return 1
+}
+func g(i int) int {
+	print("g")
+	return i + 1
+}
+func main() {
+	print(a,b,c)
+}`, "fg210")
+}
+
+func TestDeclarationCycle(t *testing.T) {
+	_, err := ParseSource(`package main
+
+var a = b
+var b = f()
+
+func f() int { return a }
+func main() {}`)
+	if err == nil {
+		t.Fatal("expected initialization cycle error")
+	}
+	if !strings.Contains(err.Error(), "initialization cycle") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDeclarationOrderAcrossFiles(t *testing.T) {
+	testProgramIn(t, "internal/testexamples/initorder", nil)
+}
+
 func TestDeclareVarAndInit(t *testing.T) {
 	testMain(t, `package main
 
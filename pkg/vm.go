@@ -27,9 +27,37 @@ type VM struct {
 	currentFrame *stackFrame // optimization
 	heap         *Heap
 	output       *bytes.Buffer // for testing only
+	// interpreted goroutines ; empty until the first go statement or blocking operation
+	routines     []*routine
+	routine      *routine // the running routine
+	routineIdSeq int
+	selectTurn   int // rotates the first case that is tried by a select
+	// if set, the only routine that takes steps unless it is waiting
+	focus *routine
+	// channels made by the interpreter ; false if passed to SDK code
+	channels map[any]bool
+	// non-nil if routines are scheduled using a seed or a recorded schedule
+	scheduler *seededScheduler
+	// non-nil if data races between routines are detected
+	race *raceDetector
+	// non-nil if variables or fields are watched by data breakpoints
+	watch *watcher
+	// non-nil if steps are recorded for stepping back ; used by debuggers
+	journal *journal
+	// if set, frames keep the arguments of their call such that they can be restarted ; used by debuggers
+	keepCallArgs bool
+	// at which panics to stop ; used by debuggers
+	exceptionBreak ExceptionBreakMode
+	// the panic at which the VM stopped ; raised again by the next step
+	pendingPanic *PanicStop
+	// replaced symbols of standard packages and builtins, by package path ("" for builtins) and name ; used to run programs in isolation
+	std map[string]map[string]reflect.Value
+	// set when the program called os.Exit and WithOsExit was used
+	exited   bool
+	exitCode int
 }
 
-func NewVM(pkg *Package) *VM {
+func NewVM(pkg *Package, options ...VMOption) *VM {
 	vm := &VM{
 		pkg:        pkg,
 		frameIdSeq: 1, // vm is created with frame 0 on stack
@@ -37,6 +65,9 @@ func NewVM(pkg *Package) *VM {
 		callStack:  make(stack[*stackFrame], 0, 16),
 		heap:       newHeap(),
 	}
+	for _, each := range options {
+		each(vm)
+	}
 	return vm
 }
 
@@ -108,6 +139,7 @@ func (vm *VM) pushNewFrame(creator Func) {
 	vm.frameIdSeq++
 	frame.callee = creator
 	env := envPool.Get().(*Environment)
+	env.journal = vm.journal
 	frame.env = env
 	//env.parentEnv = vm.currentEnv()
 	if creator != nil {
@@ -148,6 +180,10 @@ func (vm *VM) popFrame() {
 		vm.currentFrame = nil
 	}
 
+	// a recorded state can refer to the frame and its environment
+	if vm.journal != nil {
+		return
+	}
 	// return env to pool
 	env, ok := frame.env.(*Environment)
 	// skip non Environment
@@ -174,15 +210,30 @@ func (vm *VM) fatalf(format string, a ...any) {
 }
 
 // Next takes the current step and advances to the next step, returning an error if there are no more steps to take (i.e., EOF).
+// If the VM stops at a panic, depending on its exception break mode, then a *PanicStop is returned.
 // Pre: vm.currentFrame not nil
-func (vm *VM) Next() error {
-	if vm.currentFrame.step == nil {
+func (vm *VM) Next() (err error) {
+	if vm.journal != nil {
+		vm.journal.begin(vm)
+		defer func() { vm.journal.current = nil }()
+	}
+	// a pending panic belongs to the running routine
+	if vm.routine != nil && vm.pendingPanic == nil {
+		if err := vm.schedule(); err != nil {
+			return err
+		}
+	}
+	if vm.currentFrame.step == nil || vm.exited {
+		if vm.journal != nil {
+			vm.journal.cancel()
+		}
 		// EOF means function is done
 		return io.EOF
 	}
 	if trace {
 		fmt.Printf("%v @ %v\n", vm.currentFrame.step, cursor(vm.pkg.Fset, vm.currentFrame.step.pos()))
 	}
+	recovered := false // whether a panic of this step is recovered in the current frame
 	if callee := vm.currentFrame.callee; callee != nil {
 		if callee.hasRecoverCall() {
 			// console("callee has recover call", callee)
@@ -191,6 +242,7 @@ func (vm *VM) Next() error {
 			} else {
 				// for each step we need to set up a deferred function that will catch a panic.
 				// console("need to catch panic", callee)
+				recovered = true
 				defer func() {
 					if r := recover(); r != nil {
 						// console("caught panic", r, callee)
@@ -202,6 +254,23 @@ func (vm *VM) Next() error {
 			}
 		}
 	}
+	if pending := vm.pendingPanic; pending != nil {
+		// continue the panic at which the VM stopped
+		vm.pendingPanic = nil
+		panic(pending.Value)
+	}
+	if vm.exceptionBreak != BreakOnNoPanics {
+		// runs before the deferred function that recovers
+		defer func() {
+			if !vm.stopAtPanic(recovered) {
+				return
+			}
+			if r := recover(); r != nil {
+				vm.pendingPanic = vm.panicStop(r, recovered)
+				err = vm.pendingPanic
+			}
+		}()
+	}
 	vm.currentFrame.step.take(vm)
 	return nil
 }
@@ -218,10 +287,26 @@ func (vm *VM) callPackageFunction(functionName string, args []any) ([]any, error
 			if err == io.EOF {
 				break
 			}
+			if _, ok := err.(DeadlockError); ok {
+				return nil, err
+			}
+			if _, ok := err.(*PanicStop); ok {
+				return nil, err
+			}
 			return nil, fmt.Errorf("error during execution: %v", err)
 		}
 	}
+	if vm.exitCode != 0 {
+		return nil, ExitError{Code: vm.exitCode}
+	}
+	if races := vm.Races(); races > 0 {
+		return nil, RaceError{Count: races}
+	}
+	return vm.results(), nil
+}
 
+// results returns the values returned by the launched function once it has ended.
+func (vm *VM) results() []any {
 	// collect non-reflection return values
 	top := vm.currentFrame
 	vals := []any{}
@@ -229,7 +314,7 @@ func (vm *VM) callPackageFunction(functionName string, args []any) ([]any, error
 		val := top.pop()
 		vals = append(vals, val.Interface())
 	}
-	return vals, nil
+	return vals
 }
 
 // launch sets up the call flow.
@@ -268,44 +353,46 @@ func (vm *VM) launch(functionName string, args []any) {
 	vm.currentFrame.step = gb.head
 }
 
+// printStack writes the declarations, environment and operands of the current frame to stderr ;
+// stdout can be the protocol stream of a DAP session.
 func (vm *VM) printStack() {
 	if len(vm.callStack) == 0 {
-		fmt.Println("vm.ops: <empty>")
+		fmt.Fprintln(os.Stderr, "vm.ops: <empty>")
 		return
 	}
 	frame := vm.currentFrame
 	if env, ok := frame.env.(*PkgEnvironment); ok {
 		for i, decl := range env.declarations {
-			fmt.Printf("pkg.decl.%d: %v\n", i, decl)
+			fmt.Fprintf(os.Stderr, "pkg.decl.%d: %v\n", i, decl)
 			if cd, ok := decl.(ConstVarDecl); ok {
 				for s, spec := range cd.specs {
 					for n, idn := range spec.names {
-						fmt.Printf("  const.spec.%d.%d: %v\n", s, n, idn.name)
+						fmt.Fprintf(os.Stderr, "  const.spec.%d.%d: %v\n", s, n, idn.name)
 					}
 				}
 			}
 		}
 		for i, method := range env.inits {
-			fmt.Printf("pkg.init.%d: %v\n", i, method)
+			fmt.Fprintf(os.Stderr, "pkg.init.%d: %v\n", i, method)
 		}
 		for i, method := range env.methods {
-			fmt.Printf("pkg.method.%d: %v\n", i, method)
+			fmt.Fprintf(os.Stderr, "pkg.method.%d: %v\n", i, method)
 		}
 	}
 	if env, ok := frame.env.(*Environment); ok {
 		for k, v := range env.values {
 			if v.IsValid() && v.CanInterface() {
 				if v == reflectNil {
-					fmt.Printf("vm.env.%s: untyped nil\n", k)
+					fmt.Fprintf(os.Stderr, "vm.env.%s: untyped nil\n", k)
 					continue
 				}
 				if isUndeclared(v) {
-					fmt.Printf("vm.env.%s: undeclared value\n", k)
+					fmt.Fprintf(os.Stderr, "vm.env.%s: undeclared value\n", k)
 					continue
 				}
-				fmt.Printf("vm.env.%s = %s (%T)\n", k, stringOf(v.Interface()), v.Interface())
+				fmt.Fprintf(os.Stderr, "vm.env.%s = %s (%T)\n", k, stringOf(v.Interface()), v.Interface())
 			} else {
-				fmt.Printf("vm.env.%s = %s\n", k, stringOf(v))
+				fmt.Fprintf(os.Stderr, "vm.env.%s = %s\n", k, stringOf(v))
 			}
 		}
 	}
@@ -313,16 +400,16 @@ func (vm *VM) printStack() {
 		v := frame.operands[i]
 		if v.IsValid() && v.CanInterface() {
 			if v == reflectNil {
-				fmt.Printf("vm.ops.%d: untyped nil\n", i)
+				fmt.Fprintf(os.Stderr, "vm.ops.%d: untyped nil\n", i)
 				continue
 			}
 			if isUndeclared(v) {
-				fmt.Printf("vm.ops.%d: undeclared value\n", i)
+				fmt.Fprintf(os.Stderr, "vm.ops.%d: undeclared value\n", i)
 				continue
 			}
-			fmt.Printf("vm.ops.%d: %s (%T)\n", i, stringOf(v.Interface()), v.Interface())
+			fmt.Fprintf(os.Stderr, "vm.ops.%d: %s (%T)\n", i, stringOf(v.Interface()), v.Interface())
 		} else {
-			fmt.Printf("vm.ops.%d: %s\n", i, stringOf(v))
+			fmt.Fprintf(os.Stderr, "vm.ops.%d: %s\n", i, stringOf(v))
 		}
 	}
 }
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+)
+
+// DataWrite is a write to a variable or field that is watched by a data breakpoint.
+type DataWrite struct {
+	Breakpoint *Breakpoint
+	Old, New   reflect.Value
+}
+
+// Description returns the change of the value, e.g. "x changed from 1 to 2".
+func (w DataWrite) Description() string {
+	return fmt.Sprintf("%s changed from %s to %s", w.Breakpoint.Data, stringOf(w.Old), stringOf(w.New))
+}
+
+// watcher detects writes to watched memory locations ; a variable in an environment, a field of a struct value or a heap value.
+type watcher struct {
+	watches map[raceKey]*Breakpoint
+	written *DataWrite // first write of the last step to a watched location
+}
+
+// write records the write of a memory location if it is watched and the value changes.
+func (w *watcher) write(key raceKey, old, new reflect.Value) {
+	bp, ok := w.watches[key]
+	if !ok || w.written != nil {
+		return
+	}
+	if old.IsValid() && new.IsValid() && old.CanInterface() && new.CanInterface() && old.Type() == new.Type() && old.Type().Comparable() && old.Equal(new) {
+		return
+	}
+	w.written = &DataWrite{Breakpoint: bp, Old: old, New: new}
+}
+
+// watchVar checks the write of a variable in its owning environment.
+func (vm *VM) watchVar(owner Env, name string, old, new reflect.Value) {
+	if vm.watch != nil {
+		vm.watch.write(raceKey{owner: owner, name: name}, old, new)
+	}
+}
+
+// watchField checks the write of a field of an interpreted struct value.
+func (vm *VM) watchField(recv reflect.Value, name string, new reflect.Value) {
+	if vm.watch == nil {
+		return
+	}
+	if sv, ok := recv.Interface().(StructValue); ok {
+		vm.watch.write(raceKey{owner: sv.fields, name: name}, (*sv.fields)[name], new)
+	}
+}
+
+// setWatches replaces the data breakpoints ; each is watching the memory location of its key.
+func (vm *VM) setWatches(watches map[raceKey]*Breakpoint) {
+	if len(watches) == 0 {
+		vm.watch = nil
+		vm.heap.watch = nil
+		return
+	}
+	vm.watch = &watcher{watches: watches}
+	vm.heap.watch = vm.watch
+}
+
+// dataLocation returns the memory location of a variable or field expression, e.g. "x" or "s.inner.count".
+// The variable is looked up in env.
+func (vm *VM) dataLocation(env Env, expr string) (raceKey, error) {
+	x, err := parseExpr(expr)
+	if err != nil {
+		return raceKey{}, err
+	}
+	var selectors []string
+	for {
+		if sel, ok := x.(*ast.SelectorExpr); ok {
+			selectors = append([]string{sel.Sel.Name}, selectors...)
+			x = sel.X
+			continue
+		}
+		break
+	}
+	id, ok := x.(*ast.Ident)
+	if !ok {
+		return raceKey{}, fmt.Errorf("cannot watch %s: not a variable or field", expr)
+	}
+	owner, value := env.valueOwnerOf(id.Name)
+	if owner == nil || value == reflectUndeclared {
+		return raceKey{}, fmt.Errorf("cannot watch %s: undefined: %s", expr, id.Name)
+	}
+	key := raceKey{owner: owner, name: id.Name}
+	for _, each := range selectors {
+		if hp, ok := asHeapPointer(value); ok {
+			value = vm.heap.read(hp)
+		}
+		sv, ok := value.Interface().(StructValue)
+		if !ok {
+			return raceKey{}, fmt.Errorf("cannot watch %s: field %s of a value that is not a struct", expr, each)
+		}
+		value, ok = (*sv.fields)[each]
+		if !ok {
+			return raceKey{}, fmt.Errorf("cannot watch %s: no field %s", expr, each)
+		}
+		key = raceKey{owner: sv.fields, name: each}
+	}
+	// an escaped variable is written through its heap pointer
+	if hp, ok := asHeapPointer(value); ok && len(selectors) == 0 {
+		key = vm.heap.raceKey(hp)
+	}
+	return key, nil
+}